@@ -1,19 +1,98 @@
 package gopsu
 
 import (
+	"container/heap"
+	"container/list"
 	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"sync"
-	"sync/atomic"
 	"time"
 )
 
+// CacheEvictPolicy 缓存满时的淘汰策略
+type CacheEvictPolicy byte
+
+const (
+	// CacheEvictLRU 淘汰最久未被访问的数据
+	CacheEvictLRU CacheEvictPolicy = iota
+	// CacheEvictLFU 淘汰访问次数最少的数据
+	CacheEvictLFU
+	// CacheEvictFIFO 淘汰最早写入的数据
+	CacheEvictFIFO
+	// CacheEvictNone 不淘汰，缓存满时拒绝写入
+	CacheEvictNone
+)
+
+// CacheEvictReason 缓存数据被移除的原因
+type CacheEvictReason byte
+
+const (
+	// CacheReasonExpired 数据超时
+	CacheReasonExpired CacheEvictReason = iota
+	// CacheReasonDeleted 调用Delete或Clear删除
+	CacheReasonDeleted
+	// CacheReasonCapacity 缓存已满被淘汰
+	CacheReasonCapacity
+)
+
+// String 返回原因名称
+func (r CacheEvictReason) String() string {
+	switch r {
+	case CacheReasonExpired:
+		return "expired"
+	case CacheReasonDeleted:
+		return "deleted"
+	case CacheReasonCapacity:
+		return "capacity"
+	}
+	return "unknown"
+}
+
 // XCache 可设置超时的缓存字典
 type XCache struct {
-	m       map[interface{}]*xCacheData
-	len     int64
-	chanSet chan *xCacheData
-	am      sync.Map
-	amIdx   int64
+	m      map[interface{}]*xCacheData
+	len    int64
+	locker sync.Mutex
+	policy cacheEvictor
+	// onEvict 数据移除回调，在释放锁之后调用
+	onEvict func(key, value interface{}, reason CacheEvictReason)
+	evicted []xCacheEvicted
+	// expires 按超时时刻排序的最小堆，只包含设置了超时的数据
+	expires   xCacheHeap
+	wake      chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+	saving    sync.WaitGroup
+	// calls GetOrLoad正在执行的加载
+	calls      map[interface{}]*xCacheCall
+	callLocker sync.Mutex
+}
+
+// xCacheCall 单次加载，同一key的并发调用共享结果
+type xCacheCall struct {
+	wg    sync.WaitGroup
+	value interface{}
+	err   error
+}
+
+// xCacheSnapshot 缓存持久化数据结构
+type xCacheSnapshot struct {
+	Key    string      `json:"k"`
+	KeyT   string      `json:"t,omitempty"` // key的类型，空表示string
+	Value  interface{} `json:"v"`
+	Expire int64       `json:"e,omitempty"` // 超时时刻，unix毫秒，0-不超时
+}
+
+type xCacheEvicted struct {
+	key    interface{}
+	value  interface{}
+	reason CacheEvictReason
 }
 
 // xCacheData 可设置超时的缓存字典数据结构
@@ -21,37 +100,59 @@ type xCacheData struct {
 	key    interface{}
 	value  interface{}
 	expire int64
+	freq   int64
+	elm    *list.Element
+	hidx   int // 在超时堆中的位置，-1表示不在堆中
 }
 
 // NewCache 创建新的缓存字典
 //	l：字典大小,0-不限制
-func NewCache(l int64) *XCache {
+//	policy: 缓存满时的淘汰策略，默认CacheEvictLRU
+func NewCache(l int64, policy ...CacheEvictPolicy) *XCache {
+	var p = CacheEvictLRU
+	if len(policy) > 0 {
+		p = policy[0]
+	}
 	xc := &XCache{
-		m:       make(map[interface{}]*xCacheData, l),
-		len:     l,
-		chanSet: make(chan *xCacheData),
+		m:      make(map[interface{}]*xCacheData),
+		len:    l,
+		policy: newCacheEvictor(p),
+		wake:   make(chan struct{}, 1),
+		closed: make(chan struct{}),
 	}
 	go xc.run()
 	return xc
 }
 
-// Set 设置缓存数据
+// Set 设置缓存数据，缓存已满时按淘汰策略移除旧数据，策略为CacheEvictNone时返回false
 //	k: key
 //	v: value
 //	expire: 超时时间（ms）,0-不超时
 func (xc *XCache) Set(k, v interface{}, expire int64) bool {
-	if xc.amIdx >= xc.len {
-		return false
+	xc.locker.Lock()
+	defer xc.unlock()
+	// 覆盖已有数据不占用新的容量
+	if d, ok := xc.m[k]; ok {
+		d.value = v
+		xc.setExpire(d, cacheExpireAt(expire))
+		xc.policy.access(d)
+		return true
 	}
-	if expire <= 0 {
-		expire = 316224000000
+	if xc.len > 0 && int64(len(xc.m)) >= xc.len {
+		d := xc.policy.victim()
+		if d == nil {
+			return false
+		}
+		xc.remove(d, CacheReasonCapacity)
 	}
-	xc.am.Store(k, &xCacheData{
-		key:    k,
-		value:  v,
-		expire: time.Now().UnixNano()/1000000 + expire,
-	})
-	atomic.AddInt64(&xc.amIdx, 1)
+	d := &xCacheData{
+		key:   k,
+		value: v,
+		hidx:  -1,
+	}
+	xc.m[k] = d
+	xc.policy.add(d)
+	xc.setExpire(d, cacheExpireAt(expire))
 	return true
 }
 
@@ -77,49 +178,540 @@ func (xc *XCache) SetWithHold(k, v interface{}, expire, timeout int64) bool {
 
 // Get 读取缓存数据
 func (xc *XCache) Get(k interface{}) (interface{}, bool) {
-	v, ok := xc.am.Load(k)
-	if ok {
-		return v.(*xCacheData).value, true
+	v, _, ok := xc.GetWithExpire(k)
+	return v, ok
+}
+
+// GetWithExpire 读取缓存数据及剩余有效时间（ms），0表示不超时
+func (xc *XCache) GetWithExpire(k interface{}) (interface{}, int64, bool) {
+	xc.locker.Lock()
+	defer xc.unlock()
+	d, ok := xc.m[k]
+	if !ok {
+		return nil, 0, false
+	}
+	var ttl int64
+	if d.expire > 0 {
+		ttl = d.expire - time.Now().UnixNano()/1000000
+		if ttl <= 0 {
+			xc.remove(d, CacheReasonExpired)
+			return nil, 0, false
+		}
+	}
+	xc.policy.access(d)
+	return d.value, ttl, true
+}
+
+// GetOrLoad 读取缓存数据，不存在时调用loader加载并以expire（ms）写入缓存
+//	同一key并发调用时只执行一次loader，其余调用等待并共享其结果，loader返回error时不写入缓存
+func (xc *XCache) GetOrLoad(k interface{}, expire int64, loader func() (interface{}, error)) (interface{}, error) {
+	if v, ok := xc.Get(k); ok {
+		return v, nil
+	}
+	xc.callLocker.Lock()
+	if c, ok := xc.calls[k]; ok {
+		xc.callLocker.Unlock()
+		c.wg.Wait()
+		return c.value, c.err
+	}
+	if xc.calls == nil {
+		xc.calls = make(map[interface{}]*xCacheCall)
+	}
+	c := &xCacheCall{}
+	c.wg.Add(1)
+	xc.calls[k] = c
+	xc.callLocker.Unlock()
+
+	defer func() {
+		xc.callLocker.Lock()
+		delete(xc.calls, k)
+		xc.callLocker.Unlock()
+		c.wg.Done()
+	}()
+	// 首次读取与登记加载之间可能已有其他调用完成写入
+	if v, ok := xc.Get(k); ok {
+		c.value = v
+		return v, nil
+	}
+	// loader发生panic时，等待中的调用得到错误，panic继续向上传递
+	defer func() {
+		if ex := recover(); ex != nil {
+			c.value, c.err = nil, fmt.Errorf("cache loader for %v panicked: %v", k, ex)
+			panic(ex)
+		}
+	}()
+	c.value, c.err = loader()
+	if c.err == nil {
+		xc.Set(k, c.value, expire)
+	}
+	return c.value, c.err
+}
+
+// Delete 删除缓存数据
+func (xc *XCache) Delete(k interface{}) {
+	xc.locker.Lock()
+	defer xc.unlock()
+	if d, ok := xc.m[k]; ok {
+		xc.remove(d, CacheReasonDeleted)
 	}
-	return nil, false
 }
 
 // Clear 清空缓存
 func (xc *XCache) Clear() {
-	xc.am.Range(func(key interface{}, value interface{}) bool {
-		xc.am.Delete(key)
-		atomic.AddInt64(&xc.amIdx, -1)
-		return true
-	})
+	xc.locker.Lock()
+	defer xc.unlock()
+	for _, d := range xc.m {
+		xc.remove(d, CacheReasonDeleted)
+	}
 }
 
 // Len 获取缓存数量
 func (xc *XCache) Len() int64 {
-	return xc.amIdx
+	xc.locker.Lock()
+	defer xc.unlock()
+	return int64(len(xc.m))
 }
 
-func (xc *XCache) run() {
-	var exlocker sync.WaitGroup
-	var t = time.NewTicker(time.Millisecond * 10)
-RUN:
-	exlocker.Add(1)
+// OnEvict 设置数据移除回调，数据超时、删除或被淘汰时调用，覆盖写入不触发
+//	回调在缓存锁释放后执行，可以在回调中读写缓存
+func (xc *XCache) OnEvict(f func(key, value interface{}, reason CacheEvictReason)) {
+	xc.locker.Lock()
+	defer xc.unlock()
+	xc.onEvict = f
+}
+
+// Close 停止后台超时清理，已缓存的数据仍可读写，超时数据在读取时移除
+//	若启用了AutoSave，会等待最后一次保存完成
+func (xc *XCache) Close() {
+	xc.closeOnce.Do(func() {
+		close(xc.closed)
+	})
+	xc.saving.Wait()
+}
+
+// SaveTo 将缓存数据及超时时刻以CacheMarshal格式写入w
+//	key仅支持string，整数，浮点数和bool，读回后类型不变，存在其他类型的key时返回error
+//	value经json序列化，读回后数字会变为float64，结构体会变为map，建议缓存string或[]byte等简单类型
+func (xc *XCache) SaveTo(w io.Writer) error {
+	xc.locker.Lock()
+	ss := make([]*xCacheSnapshot, 0, len(xc.m))
+	for _, d := range xc.m {
+		k, t, err := cacheKeyEncode(d.key)
+		if err != nil {
+			xc.unlock()
+			return err
+		}
+		ss = append(ss, &xCacheSnapshot{
+			Key:    k,
+			KeyT:   t,
+			Value:  d.value,
+			Expire: d.expire,
+		})
+	}
+	xc.unlock()
+	b, err := CacheMarshal(ss)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// LoadFrom 从r读取SaveTo保存的数据并写入缓存，已超时的数据会被忽略，同名key会被覆盖
+func (xc *XCache) LoadFrom(r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	ss := make([]*xCacheSnapshot, 0)
+	if err = CacheUnmarshal(b, &ss); err != nil {
+		return err
+	}
+	tt := time.Now().UnixNano() / 1000000
+	for _, d := range ss {
+		k, err := cacheKeyDecode(d.Key, d.KeyT)
+		if err != nil {
+			return err
+		}
+		if d.Expire == 0 {
+			xc.Set(k, d.Value, 0)
+			continue
+		}
+		if d.Expire > tt {
+			xc.Set(k, d.Value, d.Expire-tt)
+		}
+	}
+	return nil
+}
+
+// cacheKeyEncode 将key转为字符串及类型名
+func cacheKeyEncode(k interface{}) (string, string, error) {
+	switch v := k.(type) {
+	case string:
+		return v, "", nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, bool:
+		return fmt.Sprint(v), reflect.TypeOf(v).String(), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), "float32", nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), "float64", nil
+	}
+	return "", "", fmt.Errorf("cache key type %T can not be saved", k)
+}
+
+// cacheKeyDecode 按类型名还原key
+func cacheKeyDecode(s, t string) (interface{}, error) {
+	var bits = 64
+	switch t {
+	case "":
+		return s, nil
+	case "bool":
+		return strconv.ParseBool(s)
+	case "int", "int8", "int16", "int32", "int64":
+		if t != "int" && t != "int64" {
+			bits, _ = strconv.Atoi(t[3:])
+		}
+		n, err := strconv.ParseInt(s, 10, bits)
+		if err != nil {
+			return nil, err
+		}
+		v := reflect.New(cacheKeyTypes[t]).Elem()
+		v.SetInt(n)
+		return v.Interface(), nil
+	case "uint", "uint8", "uint16", "uint32", "uint64":
+		if t != "uint" && t != "uint64" {
+			bits, _ = strconv.Atoi(t[4:])
+		}
+		n, err := strconv.ParseUint(s, 10, bits)
+		if err != nil {
+			return nil, err
+		}
+		v := reflect.New(cacheKeyTypes[t]).Elem()
+		v.SetUint(n)
+		return v.Interface(), nil
+	case "float32":
+		n, err := strconv.ParseFloat(s, 32)
+		return float32(n), err
+	case "float64":
+		return strconv.ParseFloat(s, 64)
+	}
+	return nil, fmt.Errorf("unknown cache key type %s", t)
+}
+
+var cacheKeyTypes = map[string]reflect.Type{
+	"int":    reflect.TypeOf(int(0)),
+	"int8":   reflect.TypeOf(int8(0)),
+	"int16":  reflect.TypeOf(int16(0)),
+	"int32":  reflect.TypeOf(int32(0)),
+	"int64":  reflect.TypeOf(int64(0)),
+	"uint":   reflect.TypeOf(uint(0)),
+	"uint8":  reflect.TypeOf(uint8(0)),
+	"uint16": reflect.TypeOf(uint16(0)),
+	"uint32": reflect.TypeOf(uint32(0)),
+	"uint64": reflect.TypeOf(uint64(0)),
+}
+
+// AutoSave 从DefaultCacheDir下的name文件恢复缓存，并按interval定时保存，Close时会再保存一次
+//	key的类型限制同SaveTo，存在不支持的key时本次保存失败，原文件保持不变
+//	name: 缓存文件名
+//	interval: 保存间隔，最小1s
+func (xc *XCache) AutoSave(name string, interval time.Duration) error {
+	if interval < time.Second {
+		interval = time.Second
+	}
+	if err := os.MkdirAll(DefaultCacheDir, 0775); err != nil {
+		return err
+	}
+	fn := filepath.Join(DefaultCacheDir, name)
+	if f, err := os.Open(fn); err == nil {
+		err = xc.LoadFrom(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	xc.saving.Add(1)
 	go func() {
-		defer func() {
-			recover()
-			exlocker.Done()
-		}()
-		for range t.C {
-			tt := time.Now().UnixNano() / 1000000
-			xc.am.Range(func(key interface{}, value interface{}) bool {
-				if value.(*xCacheData).expire <= tt {
-					xc.am.Delete(key)
-					atomic.AddInt64(&xc.amIdx, -1)
-				}
-				return true
-			})
+		defer xc.saving.Done()
+		var t = time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-xc.closed:
+				xc.saveFile(fn)
+				return
+			case <-t.C:
+				xc.saveFile(fn)
+			}
+		}
+	}()
+	return nil
+}
+
+// saveFile 先写临时文件再改名，避免保存中断导致文件损坏
+func (xc *XCache) saveFile(fn string) error {
+	f, err := os.OpenFile(fn+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0664)
+	if err != nil {
+		return err
+	}
+	if err = xc.SaveTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(fn+".tmp", fn)
+}
+
+// setExpire 更新超时时刻并调整超时堆，调用方需持有锁
+func (xc *XCache) setExpire(d *xCacheData, expire int64) {
+	d.expire = expire
+	switch {
+	case expire == 0 && d.hidx >= 0:
+		heap.Remove(&xc.expires, d.hidx)
+		return
+	case expire == 0:
+		return
+	case d.hidx >= 0:
+		heap.Fix(&xc.expires, d.hidx)
+	default:
+		heap.Push(&xc.expires, d)
+	}
+	// 最近的超时时刻变化，通知后台重新计时
+	if d.hidx == 0 {
+		select {
+		case xc.wake <- struct{}{}:
+		default:
 		}
+	}
+}
+
+// remove 移除数据，调用方需持有锁
+func (xc *XCache) remove(d *xCacheData, reason CacheEvictReason) {
+	delete(xc.m, d.key)
+	xc.policy.remove(d)
+	if d.hidx >= 0 {
+		heap.Remove(&xc.expires, d.hidx)
+	}
+	if xc.onEvict != nil {
+		xc.evicted = append(xc.evicted, xCacheEvicted{key: d.key, value: d.value, reason: reason})
+	}
+}
+
+// unlock 释放锁，并对期间移除的数据执行回调
+func (xc *XCache) unlock() {
+	if len(xc.evicted) == 0 {
+		xc.locker.Unlock()
+		return
+	}
+	evicted, f := xc.evicted, xc.onEvict
+	xc.evicted = nil
+	xc.locker.Unlock()
+	for _, e := range evicted {
+		f(e.key, e.value, e.reason)
+	}
+}
+
+// cacheExpireAt 计算超时时刻（ms），0表示不超时
+func cacheExpireAt(expire int64) int64 {
+	if expire <= 0 {
+		return 0
+	}
+	return time.Now().UnixNano()/1000000 + expire
+}
+
+func (xc *XCache) run() {
+	for {
+		if xc.expireLoop() {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// expireLoop 按超时堆等待并清理超时数据，Close后返回true，异常时返回false
+func (xc *XCache) expireLoop() (closed bool) {
+	defer func() {
+		recover()
 	}()
-	time.Sleep(time.Second)
-	exlocker.Wait()
-	goto RUN
+	var t = time.NewTimer(time.Hour)
+	defer t.Stop()
+	for {
+		wait := xc.expireDue()
+		if !t.Stop() {
+			select {
+			case <-t.C:
+			default:
+			}
+		}
+		if wait >= 0 {
+			t.Reset(wait)
+		}
+		select {
+		case <-xc.closed:
+			return true
+		case <-xc.wake:
+		case <-t.C:
+		}
+	}
+}
+
+// expireDue 移除所有已超时的数据，返回距下一个超时的时长，-1表示没有待超时的数据
+func (xc *XCache) expireDue() time.Duration {
+	xc.locker.Lock()
+	defer xc.unlock()
+	tt := time.Now().UnixNano() / 1000000
+	for len(xc.expires) > 0 {
+		d := xc.expires[0]
+		if d.expire > tt {
+			return time.Duration(d.expire-tt) * time.Millisecond
+		}
+		xc.remove(d, CacheReasonExpired)
+	}
+	return -1
+}
+
+// xCacheHeap 超时最小堆
+type xCacheHeap []*xCacheData
+
+func (h xCacheHeap) Len() int           { return len(h) }
+func (h xCacheHeap) Less(i, j int) bool { return h[i].expire < h[j].expire }
+func (h xCacheHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].hidx = i
+	h[j].hidx = j
+}
+
+func (h *xCacheHeap) Push(x interface{}) {
+	d := x.(*xCacheData)
+	d.hidx = len(*h)
+	*h = append(*h, d)
+}
+
+func (h *xCacheHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	d := old[n-1]
+	old[n-1] = nil
+	d.hidx = -1
+	*h = old[:n-1]
+	return d
+}
+
+// cacheEvictor 淘汰策略实现，所有方法由XCache持锁调用
+type cacheEvictor interface {
+	add(d *xCacheData)
+	access(d *xCacheData)
+	remove(d *xCacheData)
+	// victim 返回下一个应淘汰的数据，nil表示不淘汰
+	victim() *xCacheData
+}
+
+func newCacheEvictor(p CacheEvictPolicy) cacheEvictor {
+	switch p {
+	case CacheEvictLFU:
+		return &lfuEvictor{buckets: make(map[int64]*list.List)}
+	case CacheEvictFIFO:
+		return &listEvictor{l: list.New()}
+	case CacheEvictNone:
+		return &noneEvictor{}
+	default:
+		return &listEvictor{l: list.New(), lru: true}
+	}
+}
+
+// listEvictor LRU/FIFO，队首为最新数据，队尾为淘汰对象
+type listEvictor struct {
+	l   *list.List
+	lru bool
+}
+
+func (e *listEvictor) add(d *xCacheData) {
+	d.elm = e.l.PushFront(d)
+}
+
+func (e *listEvictor) access(d *xCacheData) {
+	if e.lru {
+		e.l.MoveToFront(d.elm)
+	}
+}
+
+func (e *listEvictor) remove(d *xCacheData) {
+	e.l.Remove(d.elm)
+}
+
+func (e *listEvictor) victim() *xCacheData {
+	if elm := e.l.Back(); elm != nil {
+		return elm.Value.(*xCacheData)
+	}
+	return nil
+}
+
+// lfuEvictor 按访问次数分桶，同次数内按LRU淘汰
+type lfuEvictor struct {
+	buckets map[int64]*list.List
+	minFreq int64
 }
+
+func (e *lfuEvictor) push(d *xCacheData) {
+	l, ok := e.buckets[d.freq]
+	if !ok {
+		l = list.New()
+		e.buckets[d.freq] = l
+	}
+	d.elm = l.PushFront(d)
+}
+
+func (e *lfuEvictor) add(d *xCacheData) {
+	d.freq = 1
+	e.minFreq = 1
+	e.push(d)
+}
+
+func (e *lfuEvictor) access(d *xCacheData) {
+	e.remove(d)
+	if e.minFreq == d.freq {
+		if _, ok := e.buckets[d.freq]; !ok {
+			e.minFreq++
+		}
+	}
+	d.freq++
+	e.push(d)
+}
+
+func (e *lfuEvictor) remove(d *xCacheData) {
+	l, ok := e.buckets[d.freq]
+	if !ok {
+		return
+	}
+	l.Remove(d.elm)
+	if l.Len() == 0 {
+		delete(e.buckets, d.freq)
+	}
+}
+
+func (e *lfuEvictor) victim() *xCacheData {
+	l, ok := e.buckets[e.minFreq]
+	if !ok {
+		// 删除或过期可能清空了最小桶，重新查找
+		if len(e.buckets) == 0 {
+			return nil
+		}
+		e.minFreq = 0
+		for f, b := range e.buckets {
+			if e.minFreq == 0 || f < e.minFreq {
+				e.minFreq, l = f, b
+			}
+		}
+	}
+	return l.Back().Value.(*xCacheData)
+}
+
+// noneEvictor 不淘汰
+type noneEvictor struct{}
+
+func (e *noneEvictor) add(d *xCacheData)    {}
+func (e *noneEvictor) access(d *xCacheData) {}
+func (e *noneEvictor) remove(d *xCacheData) {}
+func (e *noneEvictor) victim() *xCacheData  { return nil }
@@ -0,0 +1,275 @@
+package gopsu
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sweepExpired 旧版XCache的超时清理：每次遍历全部数据
+func sweepExpired(m *sync.Map) {
+	tt := time.Now().UnixNano() / 1000000
+	m.Range(func(key interface{}, value interface{}) bool {
+		if value.(*xCacheData).expire <= tt {
+			m.Delete(key)
+		}
+		return true
+	})
+}
+
+// BenchmarkXCacheExpiry 比较一次超时检查的开销，数据均未超时
+func BenchmarkXCacheExpiry(b *testing.B) {
+	for _, n := range []int{1000, 100000, 500000} {
+		b.Run(fmt.Sprintf("heap-%d", n), func(b *testing.B) {
+			xc := NewCache(0)
+			defer xc.Close()
+			for i := 0; i < n; i++ {
+				xc.Set(i, i, int64(time.Hour/time.Millisecond))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				xc.expireDue()
+			}
+		})
+		b.Run(fmt.Sprintf("sweep-%d", n), func(b *testing.B) {
+			var m sync.Map
+			expire := cacheExpireAt(int64(time.Hour / time.Millisecond))
+			for i := 0; i < n; i++ {
+				m.Store(i, &xCacheData{key: i, value: i, expire: expire})
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				sweepExpired(&m)
+			}
+		})
+	}
+}
+
+func TestXCacheEvictPolicy(t *testing.T) {
+	cases := []struct {
+		policy CacheEvictPolicy
+		victim string
+	}{
+		// 写入顺序b,a,c,d；a访问最多但最早，d访问最少但最近
+		{CacheEvictLRU, "a"},
+		{CacheEvictLFU, "d"},
+		{CacheEvictFIFO, "b"},
+		{CacheEvictNone, ""},
+	}
+	for _, tc := range cases {
+		xc := NewCache(4, tc.policy)
+		for _, k := range []string{"b", "a", "c", "d"} {
+			xc.Set(k, k, 0)
+		}
+		for _, k := range []string{"a", "a", "a", "c", "c", "b", "b", "d"} {
+			xc.Get(k)
+		}
+		ok := xc.Set("e", "e", 0)
+		if tc.victim == "" {
+			if ok {
+				t.Errorf("policy %d: Set should fail when full", tc.policy)
+			}
+		} else {
+			if !ok {
+				t.Errorf("policy %d: Set failed", tc.policy)
+			}
+			if _, found := xc.Get(tc.victim); found {
+				t.Errorf("policy %d: %s should be evicted", tc.policy, tc.victim)
+			}
+			if _, found := xc.Get("e"); !found {
+				t.Errorf("policy %d: new key missing", tc.policy)
+			}
+		}
+		if xc.Len() != 4 {
+			t.Errorf("policy %d: Len = %d", tc.policy, xc.Len())
+		}
+		xc.Close()
+	}
+}
+
+func TestXCacheLen(t *testing.T) {
+	xc := NewCache(0)
+	defer xc.Close()
+	steps := []struct {
+		name string
+		do   func()
+		want int64
+	}{
+		{"set", func() { xc.Set("a", 1, 0); xc.Set("b", 2, 0); xc.Set("c", 3, 0) }, 3},
+		{"overwrite", func() { xc.Set("a", 10, 0); xc.Set("b", 20, 60000) }, 3},
+		{"delete", func() { xc.Delete("a") }, 2},
+		{"delete missing", func() { xc.Delete("a"); xc.Delete("x") }, 2},
+		{"expired on read", func() {
+			xc.Set("d", 4, 1)
+			time.Sleep(5 * time.Millisecond)
+			xc.Get("d")
+		}, 2},
+		{"clear", func() { xc.Clear() }, 0},
+		{"set after clear", func() { xc.Set("a", 1, 0) }, 1},
+	}
+	for _, st := range steps {
+		st.do()
+		if n := xc.Len(); n != st.want {
+			t.Errorf("%s: Len = %d, want %d", st.name, n, st.want)
+		}
+	}
+}
+
+func TestXCacheGetWithExpire(t *testing.T) {
+	xc := NewCache(0)
+	defer xc.Close()
+	xc.Set("ttl", "v", 60000)
+	xc.Set("forever", "v", 0)
+	if v, ttl, ok := xc.GetWithExpire("ttl"); !ok || v != "v" || ttl <= 59000 || ttl > 60000 {
+		t.Errorf("ttl = %v %d %v", v, ttl, ok)
+	}
+	if _, ttl, ok := xc.GetWithExpire("forever"); !ok || ttl != 0 {
+		t.Errorf("forever ttl = %d %v", ttl, ok)
+	}
+	if _, _, ok := xc.GetWithExpire("missing"); ok {
+		t.Error("missing key found")
+	}
+}
+
+func TestXCacheOnEvict(t *testing.T) {
+	type evicted struct {
+		key    interface{}
+		reason CacheEvictReason
+	}
+	xc := NewCache(2, CacheEvictFIFO)
+	defer xc.Close()
+	ch := make(chan evicted, 10)
+	xc.OnEvict(func(key, value interface{}, reason CacheEvictReason) {
+		// 回调中可以读写缓存
+		xc.Len()
+		ch <- evicted{key, reason}
+	})
+	cases := []struct {
+		name string
+		do   func()
+		want []evicted
+	}{
+		{"overwrite", func() { xc.Set("a", 1, 0); xc.Set("a", 2, 0) }, nil},
+		{"delete", func() { xc.Delete("a") }, []evicted{{"a", CacheReasonDeleted}}},
+		{"capacity", func() { xc.Set("b", 1, 0); xc.Set("c", 1, 0); xc.Set("d", 1, 0) }, []evicted{{"b", CacheReasonCapacity}}},
+		{"expired", func() { xc.Set("e", 1, 20) }, []evicted{{"c", CacheReasonCapacity}, {"e", CacheReasonExpired}}},
+	}
+	for _, tc := range cases {
+		tc.do()
+		for _, want := range tc.want {
+			select {
+			case got := <-ch:
+				if got != want {
+					t.Errorf("%s: got %v, want %v", tc.name, got, want)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("%s: no callback for %v", tc.name, want)
+			}
+		}
+		select {
+		case got := <-ch:
+			t.Errorf("%s: unexpected callback %v", tc.name, got)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func TestXCacheHeapExpiry(t *testing.T) {
+	xc := NewCache(0)
+	defer xc.Close()
+	var order []interface{}
+	var locker sync.Mutex
+	xc.OnEvict(func(key, value interface{}, reason CacheEvictReason) {
+		locker.Lock()
+		order = append(order, key)
+		locker.Unlock()
+	})
+	// 写入顺序与超时顺序不同，覆盖写入会调整超时时刻
+	xc.Set("c", 1, 90)
+	xc.Set("a", 1, 30)
+	xc.Set("b", 1, 60)
+	xc.Set("keep", 1, 0)
+	xc.Set("moved", 1, 10)
+	xc.Set("moved", 1, 120)
+	time.Sleep(300 * time.Millisecond)
+	locker.Lock()
+	got := fmt.Sprint(order)
+	locker.Unlock()
+	if got != "[a b c moved]" {
+		t.Errorf("expire order = %s", got)
+	}
+	if xc.Len() != 1 {
+		t.Errorf("Len = %d", xc.Len())
+	}
+}
+
+func TestXCacheClose(t *testing.T) {
+	xc := NewCache(0)
+	xc.Close()
+	xc.Close()
+	// 关闭后不再后台清理，读取时移除超时数据
+	xc.Set("a", 1, 10)
+	time.Sleep(50 * time.Millisecond)
+	if xc.Len() != 1 {
+		t.Errorf("Len after close = %d", xc.Len())
+	}
+	if _, ok := xc.Get("a"); ok {
+		t.Error("expired key readable after close")
+	}
+	if xc.Len() != 0 {
+		t.Errorf("Len after read = %d", xc.Len())
+	}
+}
+
+func TestXCacheSnapshot(t *testing.T) {
+	keys := []interface{}{
+		"s", int(1), int8(-2), int16(3), int32(4), int64(-5),
+		uint(6), uint8(7), uint16(8), uint32(9), uint64(10),
+		float32(1.5), float64(-2.25), true,
+	}
+	src := NewCache(0)
+	defer src.Close()
+	for _, k := range keys {
+		src.Set(k, fmt.Sprint(k), 60000)
+	}
+	src.Set("forever", "v", 0)
+	src.Set("expired", "v", 1)
+	time.Sleep(5 * time.Millisecond)
+	var buf bytes.Buffer
+	if err := src.SaveTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dst := NewCache(0)
+	defer dst.Close()
+	if err := dst.LoadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range keys {
+		v, ttl, ok := dst.GetWithExpire(k)
+		if !ok || v != fmt.Sprint(k) {
+			t.Errorf("%T(%v): got %v, %v", k, k, v, ok)
+		}
+		if ttl <= 50000 || ttl > 60000 {
+			t.Errorf("%T(%v): ttl = %d", k, k, ttl)
+		}
+	}
+	if _, ttl, ok := dst.GetWithExpire("forever"); !ok || ttl != 0 {
+		t.Errorf("forever: ttl = %d, %v", ttl, ok)
+	}
+	if _, ok := dst.Get("expired"); ok {
+		t.Error("expired key restored")
+	}
+	// 同值不同类型的key保持区分
+	if _, ok := dst.Get("1"); ok {
+		t.Error("int key restored as string")
+	}
+
+	bad := NewCache(0)
+	defer bad.Close()
+	bad.Set(struct{ A int }{1}, "v", 0)
+	if err := bad.SaveTo(&buf); err == nil {
+		t.Error("SaveTo with struct key should fail")
+	}
+}
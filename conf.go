@@ -1,15 +1,15 @@
 package gopsu
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
-	"io"
-	"os"
+	"io/ioutil"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // 配置项结构体
@@ -17,52 +17,168 @@ type confItem struct {
 	key    string
 	value  string
 	remark string
+	seq    uint64
+	orig   interface{} // yaml，toml，json格式中的原始值，保存时按原类型写入
+	src    ConfSource
+}
+
+const (
+	confLineRaw    = iota // 空行或无法识别的行
+	confLineRemark        // 注释行
+	confLineItem          // 配置行
+)
+
+// confLine 配置文件中的一行，用于保存时保持原有的顺序，空行和注释位置
+type confLine struct {
+	kind   int
+	raw    string
+	key    string
+	value  string
+	remark string    // 配置行上方紧邻的注释
+	owner  *confLine // 注释行所属的配置行
 }
 
 // ConfData 配置文件结构体
 type ConfData struct {
-	items        sync.Map
+	items        atomic.Value // *sync.Map，重新读取时整体替换
+	itemsOnce    sync.Once
 	fileFullPath string
 	fileName     string
+	seq          uint64
+	locker       sync.Mutex
+	lines        []*confLine
+	newline      string
+	format       ConfFormat
+	watcher      confWatcher
+	envPrefix    atomic.Value // string，未设置时不读取环境变量
+	overrides    sync.Map
+	cWorker      atomic.Value // *CryptoWorker，用于解密ENC(...)格式的值
+}
+
+// parseConfLines 解析配置文件内容，注释以#开头，值可以用双引号包含以使用首尾空格等字符
+func parseConfLines(data string) ([]*confLine, string) {
+	newline := "\n"
+	if strings.Contains(data, "\r\n") {
+		newline = "\r\n"
+	}
+	data = strings.TrimSuffix(strings.Replace(data, "\r\n", "\n", -1), "\n")
+	lines := make([]*confLine, 0)
+	if data == "" {
+		return lines, "\r\n"
+	}
+	var remarks = make([]*confLine, 0)
+	for _, raw := range strings.Split(data, "\n") {
+		ln := &confLine{raw: raw}
+		lines = append(lines, ln)
+		line := TrimString(raw)
+		if strings.HasPrefix(line, "#") {
+			ln.kind = confLineRemark
+			remarks = append(remarks, ln)
+			continue
+		}
+		s := strings.SplitN(line, "=", 2)
+		if len(s) == 2 && TrimString(s[0]) != "" {
+			ln.kind = confLineItem
+			ln.key = TrimString(s[0])
+			ln.value = unquoteConfValue(TrimString(s[1]))
+			rs := make([]string, len(remarks))
+			for i, r := range remarks {
+				r.owner = ln
+				rs[i] = TrimString(r.raw)
+			}
+			ln.remark = strings.Join(rs, "\n")
+		}
+		remarks = remarks[:0]
+	}
+	return lines, newline
+}
+
+// unquoteConfValue 去除值两端的双引号
+func unquoteConfValue(s string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, "\"") && strings.HasSuffix(s, "\"") {
+		if v, err := strconv.Unquote(s); err == nil {
+			return v
+		}
+	}
+	return s
+}
+
+// quoteConfValue 值含首尾空格，#，换行或以双引号开头时加双引号
+func quoteConfValue(s string) string {
+	if s != TrimString(s) || strings.ContainsAny(s, "#\r\n") || strings.HasPrefix(s, "\"") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// formatConfRemark 将说明转换为注释行，多行说明以\n分隔
+func formatConfRemark(remark string) []string {
+	ss := make([]string, 0)
+	for _, v := range strings.Split(strings.Replace(remark, "\r\n", "\n", -1), "\n") {
+		v = TrimString(v)
+		if v == "" || v == "#" {
+			continue
+		}
+		if !strings.HasPrefix(v, "#") {
+			v = "#" + v
+		}
+		ss = append(ss, v)
+	}
+	return ss
 }
 
 // Reload reload config file
 func (c *ConfData) Reload() error {
-	if IsExist(c.fileFullPath) {
-		file, ex := os.Open(c.fileFullPath)
-		if ex != nil {
-			return ex
-		}
-		defer file.Close()
-		c.Clear()
-		var remarkbuf bytes.Buffer
-		buf := bufio.NewReader(file)
-		for {
-			line, ex := buf.ReadString('\n')
-			if ex != nil || io.EOF == ex {
-				break
-			}
-			line = TrimString(line)
-			if len(line) == 0 {
-				remarkbuf.WriteString("\r\n")
-				continue
-			}
-			if strings.Contains(line, "#") && strings.Index(line, "#") < 5 {
-				remarkbuf.WriteString(line)
-				continue
-			} else {
-				s := strings.SplitN(line, "=", 2)
-				if len(s) > 1 {
-					if len(s[1]) > 0 {
-						c.SetItem(s[0], s[1], remarkbuf.String())
-					}
-				}
-				remarkbuf.Reset()
-			}
+	if !IsExist(c.fileFullPath) {
+		return fmt.Errorf("file not found")
+	}
+	b, err := ioutil.ReadFile(c.fileFullPath)
+	if err != nil {
+		return err
+	}
+	if c.format != ConfFormatKV {
+		m, err := c.parseFormat(b)
+		if err != nil {
+			return err
 		}
+		if err := c.checkEncrypted(m); err != nil {
+			return err
+		}
+		c.replaceItems(m)
 		return nil
 	}
-	return fmt.Errorf("file not found")
+	lines, newline := parseConfLines(string(b))
+	m := &sync.Map{}
+	for _, ln := range lines {
+		// 值可能含有引号包含的首尾空格，不使用SetItem
+		if ln.kind == confLineItem && ln.value != "" {
+			m.Store(ln.key, &confItem{
+				key:    ln.key,
+				value:  ln.value,
+				remark: ln.remark,
+				seq:    atomic.AddUint64(&c.seq, 1),
+				src:    ConfSourceFile,
+			})
+		}
+	}
+	if err := c.checkEncrypted(m); err != nil {
+		return err
+	}
+	c.locker.Lock()
+	c.lines, c.newline = lines, newline
+	c.locker.Unlock()
+	c.replaceItems(m)
+	return nil
+}
+
+// data 当前的配置项
+func (c *ConfData) data() *sync.Map {
+	c.itemsOnce.Do(func() {
+		if c.items.Load() == nil {
+			c.items.Store(&sync.Map{})
+		}
+	})
+	return c.items.Load().(*sync.Map)
 }
 
 // UpdateItem 更新配置项
@@ -70,7 +186,7 @@ func (c *ConfData) UpdateItem(key, value string) bool {
 	key = TrimString(key)
 	value = TrimString(value)
 	var found = false
-	c.items.Range(func(k, v interface{}) bool {
+	c.data().Range(func(k, v interface{}) bool {
 		if k.(string) == key {
 			v.(*confItem).value = value
 			found = true
@@ -83,102 +199,186 @@ func (c *ConfData) UpdateItem(key, value string) bool {
 
 // DelItem 删除配置项
 func (c *ConfData) DelItem(key string) {
-	c.items.Delete(key)
+	c.data().Delete(key)
 }
 
 // SetItem 设置配置项
 func (c *ConfData) SetItem(key, value, remark string) bool {
-	// defer return false
+	return c.setItem(key, value, remark, ConfSourceFile)
+}
+
+func (c *ConfData) setItem(key, value, remark string, src ConfSource) bool {
 	key = TrimString(key)
 	value = TrimString(value)
 	if !strings.HasPrefix(remark, "#") {
 		remark = fmt.Sprintf("#%s", TrimString(remark))
 	}
-	c.items.Store(key, &confItem{
+	item := &confItem{
 		key:    key,
 		value:  value,
 		remark: remark,
-	})
+		src:    src,
+	}
+	// 已有的配置项保持原有的顺序和类型，未指定说明时保留原有说明
+	if v, ok := c.data().Load(key); ok {
+		item.seq = v.(*confItem).seq
+		item.orig = v.(*confItem).orig
+		if item.remark == "#" {
+			item.remark = v.(*confItem).remark
+		}
+	} else {
+		item.seq = atomic.AddUint64(&c.seq, 1)
+	}
+	c.data().Store(key, item)
 	return true
 }
 
-// GetItemDefault 获取配置项的value
+// GetItemDefault 获取配置项的value，配置文件中没有该配置项时，使用value和remark添加配置项
+//	环境变量和命令行参数的值优先于配置文件，参见SetEnvPrefix，SetOverride
+//	已有的加密配置项解密失败时返回空字符串，不会使用value，需要区分时使用GetItem
 func (c *ConfData) GetItemDefault(key, value string, remark ...string) string {
-	v, err := c.GetItem(key)
-	if err != nil {
-		c.SetItem(key, value, remark[0])
-		v = TrimString(value)
+	if _, ok := c.data().Load(key); !ok {
+		var r string
+		if len(remark) > 0 {
+			r = remark[0]
+		}
+		c.setItem(key, value, r, ConfSourceDefault)
 	}
+	v, _ := c.GetItem(key)
 	return v
 }
 
-// GetItem 获取配置项的value
+// GetItem 获取配置项的value，依次查找命令行参数，环境变量和配置文件，ENC(...)格式的值会自动解密
 func (c *ConfData) GetItem(key string) (string, error) {
-	v, ok := c.items.Load(key)
-	if ok {
-		return v.(*confItem).value, nil
+	v, ok := c.lookup(key)
+	if !ok {
+		return "", fmt.Errorf("key does not exist")
 	}
-	return "", fmt.Errorf("key does not exist")
+	return c.decryptValue(v)
+}
+
+// lookup 获取配置项未解密的值
+func (c *ConfData) lookup(key string) (string, bool) {
+	if v, src := c.override(key); src != ConfSourceNone {
+		return v, true
+	}
+	if v, ok := c.data().Load(key); ok {
+		return v.(*confItem).value, true
+	}
+	return "", false
 }
 
 // GetItemDetail 获取配置项的value
 func (c *ConfData) GetItemDetail(key string) (string, string, error) {
-	v, ok := c.items.Load(key)
-	if ok {
-		return v.(*confItem).value, v.(*confItem).remark, nil
+	value, err := c.GetItem(key)
+	if err != nil {
+		return "", "", err
 	}
-	return "", "", fmt.Errorf("key does not exist")
+	if v, ok := c.data().Load(key); ok {
+		return value, v.(*confItem).remark, nil
+	}
+	return value, "", nil
 }
 
 // GetKeys 获取所有配置项的key
 func (c *ConfData) GetKeys() []string {
 	var keys = make([]string, 0)
-	c.items.Range(func(k, v interface{}) bool {
+	c.data().Range(func(k, v interface{}) bool {
 		keys = append(keys, k.(string))
 		return true
 	})
 	return keys
 }
 
-// Save 保存配置文件
+// Save 保存配置文件，保持原有的顺序，空行和注释，只更新修改过的配置项，新配置项添加在文件末尾
+//	已删除的配置项连同其上方紧邻的注释一起删除
 func (c *ConfData) Save() error {
-	file, ex := os.OpenFile(c.fileFullPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
-	if ex != nil {
-		return ex
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	if c.format != ConfFormatKV {
+		b, err := c.encodeFormat()
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(c.fileFullPath, b, 0666)
 	}
-	defer file.Close()
-	var err error
-	var ss = make([]*confItem, c.Len())
-	var i int
-	c.items.Range(func(k, v interface{}) bool {
-		ss[i] = v.(*confItem)
-		i++
+	nl := c.newline
+	if nl == "" {
+		nl = "\r\n"
+	}
+	var b bytes.Buffer
+	var written = make(map[string]bool)
+	for _, ln := range c.lines {
+		switch ln.kind {
+		case confLineRemark:
+			// 所属配置项已删除时一并删除
+			if ln.owner != nil && ln.owner.value != "" {
+				if _, ok := c.data().Load(ln.owner.key); !ok {
+					continue
+				}
+			}
+		case confLineItem:
+			if written[ln.key] {
+				continue
+			}
+			v, ok := c.data().Load(ln.key)
+			if !ok {
+				// 值为空的配置行原样保留，其他视为已删除
+				if ln.value == "" {
+					b.WriteString(ln.raw + nl)
+				}
+				continue
+			}
+			item := v.(*confItem)
+			written[ln.key] = true
+			// 文件中已有的注释优先，没有注释时写入说明
+			if ln.remark == "" {
+				for _, r := range formatConfRemark(item.remark) {
+					b.WriteString(r + nl)
+				}
+			}
+			if item.value == ln.value {
+				b.WriteString(ln.raw + nl)
+			} else {
+				b.WriteString(item.key + "=" + quoteConfValue(item.value) + nl)
+			}
+			continue
+		}
+		b.WriteString(ln.raw + nl)
+	}
+	// 新配置项按添加顺序写入
+	var ss = make([]*confItem, 0)
+	c.data().Range(func(k, v interface{}) bool {
+		if !written[k.(string)] {
+			ss = append(ss, v.(*confItem))
+		}
 		return true
 	})
 	sort.Slice(ss, func(i, j int) bool {
-		return ss[i].key < ss[j].key
+		return ss[i].seq < ss[j].seq
 	})
 	for _, v := range ss {
-		remark := make([]string, 0)
-		x := strings.Split(v.remark, "#")
-		for _, v := range x {
-			if TrimString(v) != "" {
-				remark = append(remark, "#"+v)
-			}
+		if b.Len() > 0 && !bytes.HasSuffix(b.Bytes(), []byte(nl+nl)) {
+			b.WriteString(nl)
 		}
-		_, ex := file.WriteString(fmt.Sprintf("%s\r\n%s=%s\r\n\r\n", strings.Join(remark, "\r\n"), v.key, v.value))
-		if ex != nil {
-			return ex
+		for _, r := range formatConfRemark(v.remark) {
+			b.WriteString(r + nl)
 		}
+		b.WriteString(v.key + "=" + quoteConfValue(v.value) + nl)
+	}
+	if err := ioutil.WriteFile(c.fileFullPath, b.Bytes(), 0666); err != nil {
+		return err
 	}
-	return err
+	c.lines, c.newline = parseConfLines(b.String())
+	return nil
 }
 
-// GetAll 获取所有配置项的key，value，以json字符串返回
+// GetAll 获取所有配置项的key，value，以json字符串返回，加密的值不解密
 func (c *ConfData) GetAll() string {
 	var s = make([]string, 0, c.Len())
-	c.items.Range(func(k, v interface{}) bool {
-		s = append(s, fmt.Sprintf("\"%s\":\"%s\"", v.(*confItem).key, v.(*confItem).value))
+	c.data().Range(func(k, v interface{}) bool {
+		value, _ := c.lookup(k.(string))
+		s = append(s, fmt.Sprintf("\"%s\":\"%s\"", v.(*confItem).key, value))
 		return true
 	})
 	return fmt.Sprintf("{%s}", strings.Join(s, ","))
@@ -186,16 +386,14 @@ func (c *ConfData) GetAll() string {
 
 // Clear 清除所有配置项
 func (c *ConfData) Clear() {
-	c.items.Range(func(k, v interface{}) bool {
-		c.items.Delete(k)
-		return true
-	})
+	c.data()
+	c.items.Store(&sync.Map{})
 }
 
 // Len 获取配置数量
 func (c *ConfData) Len() int {
 	var i int
-	c.items.Range(func(k, v interface{}) bool {
+	c.data().Range(func(k, v interface{}) bool {
 		i++
 		return true
 	})
@@ -207,11 +405,29 @@ func (c *ConfData) FullPath() string {
 	return c.fileFullPath
 }
 
+// Format 配置文件格式
+func (c *ConfData) Format() ConfFormat {
+	return c.format
+}
+
 // LoadConfig load config file
-func LoadConfig(fullpath string) (*ConfData, error) {
+//	format: 配置文件格式，未指定时按扩展名判断，参见ConfFormatByExt
+//	yaml，toml，json格式中嵌套的键以.连接，如 db.server，数组以逗号连接
+//	yaml，json格式保存时不保留注释，toml格式以配置项说明作为注释，文件已存在时不会自动保存
+func LoadConfig(fullpath string, format ...ConfFormat) (*ConfData, error) {
 	c := &ConfData{
 		fileFullPath: fullpath,
 		fileName:     path.Base(fullpath),
+		format:       ConfFormatByExt(fullpath),
+	}
+	if len(format) > 0 {
+		c.format = format[0]
+	}
+	if c.format != ConfFormatKV {
+		if !IsExist(fullpath) {
+			return c, c.Save()
+		}
+		return c, c.Reload()
 	}
 	c.Reload()
 	ex := c.Save()
@@ -0,0 +1,81 @@
+package gopsu
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestConfSaveKeepsLayout(t *testing.T) {
+	const src = "# 服务配置\n" +
+		"\n" +
+		"# 名称\n" +
+		"name = svc\n" +
+		"url=\"http://host/a?b=1#top\"\n" +
+		"pad=\"  x  \"\n" +
+		"\n" +
+		"# 将被删除\n" +
+		"old=1\n" +
+		"empty=\n" +
+		"port=8080\n"
+	c := loadTestConf(t, "app.conf", src)
+	cases := []struct {
+		key, want string
+	}{
+		{"name", "svc"},
+		{"url", "http://host/a?b=1#top"},
+		{"pad", "  x  "},
+		{"port", "8080"},
+	}
+	for _, tc := range cases {
+		if v, _ := c.GetItem(tc.key); v != tc.want {
+			t.Errorf("%s = %q, want %q", tc.key, v, tc.want)
+		}
+	}
+	c.UpdateItem("port", "9090")
+	c.DelItem("old")
+	c.SetItem("new", "a#b", "新配置项")
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(c.FullPath())
+	const want = "# 服务配置\n" +
+		"\n" +
+		"# 名称\n" +
+		"name = svc\n" +
+		"url=\"http://host/a?b=1#top\"\n" +
+		"pad=\"  x  \"\n" +
+		"\n" +
+		"empty=\n" +
+		"port=9090\n" +
+		"\n" +
+		"#新配置项\n" +
+		"new=\"a#b\"\n"
+	if string(b) != want {
+		t.Errorf("saved:\n%s\nwant:\n%s", b, want)
+	}
+	// 再次读取值不变，未修改时保存结果不变
+	c2, err := LoadConfig(c.FullPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := c2.GetItem("new"); v != "a#b" {
+		t.Errorf("new = %q", v)
+	}
+	if err := c2.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if b2, _ := ioutil.ReadFile(c.FullPath()); string(b2) != want {
+		t.Errorf("second save changed file:\n%s", b2)
+	}
+}
+
+func TestConfSaveCRLF(t *testing.T) {
+	c := loadTestConf(t, "crlf.conf", "# a\r\na=1\r\n")
+	c.UpdateItem("a", "2")
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(c.FullPath()); string(b) != "# a\r\na=2\r\n" {
+		t.Errorf("saved %q", b)
+	}
+}
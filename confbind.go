@@ -0,0 +1,209 @@
+package gopsu
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	typeDuration        = reflect.TypeOf(time.Duration(0))
+	typeTextUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Bind 按字段tag读取配置项并填充结构体，v必须为结构体指针
+//	conf: 配置项名称，为"-"或未设置时忽略该字段，嵌套结构体的conf作为其字段的前缀，如 db.server
+//	default: 缺省值，未设置时使用字段当前值
+//	remark: 配置项说明
+// 支持string，bool，int，uint（十进制），float，time.Duration（纯数字时单位为秒），以逗号分隔的切片，
+// 实现了encoding.TextUnmarshaler的类型（如time.Time，格式为RFC3339），以及嵌套结构体（或其指针）
+// 缺少的配置项会使用缺省值和说明写入配置，需调用Save保存到文件
+func (c *ConfData) Bind(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind target must be a non-nil struct pointer")
+	}
+	return c.bindStruct(rv.Elem(), "")
+}
+
+func (c *ConfData) bindStruct(rv reflect.Value, prefix string) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" { // 未导出字段
+			continue
+		}
+		fv := rv.Field(i)
+		key, ok := sf.Tag.Lookup("conf")
+		if key == "-" {
+			continue
+		}
+		// 嵌套结构体，time.Time等实现了文本解析的结构体不展开
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && !reflect.PtrTo(ft).Implements(typeTextUnmarshaler) {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv.Set(reflect.New(ft))
+				}
+				fv = fv.Elem()
+			}
+			p := prefix
+			if key != "" {
+				p = prefix + key + "."
+			}
+			if err := c.bindStruct(fv, p); err != nil {
+				return err
+			}
+			continue
+		}
+		if !ok || key == "" {
+			continue
+		}
+		key = prefix + key
+		if v, ok := c.data().Load(key); !ok || v.(*confItem).value == "" {
+			s, ok := sf.Tag.Lookup("default")
+			if !ok && !fv.IsZero() {
+				s = formatConfValue(fv)
+			}
+			c.setItem(key, s, sf.Tag.Get("remark"), ConfSourceDefault)
+		}
+		s, err := c.GetItem(key)
+		if err != nil {
+			return fmt.Errorf("conf %s: %s", key, err.Error())
+		}
+		if err := setConfValue(fv, s); err != nil {
+			return fmt.Errorf("conf %s: %s", key, err.Error())
+		}
+	}
+	return nil
+}
+
+// setConfValue 将字符串转换为字段类型并赋值
+func setConfValue(fv reflect.Value, s string) error {
+	s = TrimString(s)
+	if fv.Kind() == reflect.Ptr && reflect.PtrTo(fv.Type().Elem()).Implements(typeTextUnmarshaler) {
+		if s == "" {
+			fv.Set(reflect.Zero(fv.Type()))
+			return nil
+		}
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		fv = fv.Elem()
+	}
+	if reflect.PtrTo(fv.Type()).Implements(typeTextUnmarshaler) {
+		if s == "" {
+			fv.Set(reflect.Zero(fv.Type()))
+			return nil
+		}
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	if fv.Type() == typeDuration {
+		if s == "" {
+			fv.SetInt(0)
+			return nil
+		}
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			fv.SetInt(n * int64(time.Second))
+			return nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		if s == "" {
+			fv.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s == "" {
+			fv.SetInt(0)
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if s == "" {
+			fv.SetUint(0)
+			return nil
+		}
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if s == "" {
+			fv.SetFloat(0)
+			return nil
+		}
+		n, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(n)
+	case reflect.Slice:
+		if s == "" {
+			fv.Set(reflect.MakeSlice(fv.Type(), 0, 0))
+			return nil
+		}
+		ss := strings.Split(s, ",")
+		sv := reflect.MakeSlice(fv.Type(), len(ss), len(ss))
+		for i, v := range ss {
+			if err := setConfValue(sv.Index(i), v); err != nil {
+				return err
+			}
+		}
+		fv.Set(sv)
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type().String())
+	}
+	return nil
+}
+
+// formatConfValue 将字段值转换为配置文件中的字符串
+func formatConfValue(fv reflect.Value) string {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return ""
+		}
+		fv = fv.Elem()
+	}
+	if m, ok := fv.Interface().(encoding.TextMarshaler); ok {
+		if b, err := m.MarshalText(); err == nil {
+			return string(b)
+		}
+	}
+	if fv.Type() == typeDuration {
+		return time.Duration(fv.Int()).String()
+	}
+	if fv.Kind() == reflect.Slice {
+		ss := make([]string, fv.Len())
+		for i := 0; i < fv.Len(); i++ {
+			ss[i] = formatConfValue(fv.Index(i))
+		}
+		return strings.Join(ss, ",")
+	}
+	return fmt.Sprint(fv.Interface())
+}
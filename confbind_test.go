@@ -0,0 +1,109 @@
+package gopsu
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func loadTestConf(t *testing.T, name, text string) *ConfData {
+	fn := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(fn, []byte(text), 0664); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConfig(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+type testBindDB struct {
+	Server  string        `conf:"server" default:"127.0.0.1:3306"`
+	Timeout time.Duration `conf:"timeout" default:"5"`
+}
+
+type testBindConf struct {
+	Port    int        `conf:"port"`
+	Workers uint8      `conf:"workers" default:"4"`
+	Ratio   float64    `conf:"ratio"`
+	Debug   bool       `conf:"debug"`
+	Tags    []string   `conf:"tags"`
+	Ports   []int      `conf:"ports"`
+	Start   time.Time  `conf:"start"`
+	Stop    *time.Time `conf:"stop"`
+	DB      testBindDB `conf:"db"`
+	Skip    string     `conf:"-"`
+	Keep    string
+}
+
+func TestConfBind(t *testing.T) {
+	c := loadTestConf(t, "bind.conf", `port=010
+ratio=0.5
+debug=true
+tags=a,b
+ports=08,9
+start=2021-06-01T08:00:00Z
+stop=2021-06-02T08:00:00+08:00
+db.timeout=1m30s
+`)
+	var v testBindConf
+	v.Keep = "keep"
+	if err := c.Bind(&v); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"port", v.Port, 10},
+		{"workers", v.Workers, uint8(4)},
+		{"ratio", v.Ratio, 0.5},
+		{"debug", v.Debug, true},
+		{"tags", len(v.Tags) == 2 && v.Tags[1] == "b", true},
+		{"ports", len(v.Ports) == 2 && v.Ports[0] == 8 && v.Ports[1] == 9, true},
+		{"start", v.Start.Equal(start), true},
+		{"stop", v.Stop != nil && v.Stop.Equal(start.Add(16*time.Hour)), true},
+		{"db.server", v.DB.Server, "127.0.0.1:3306"},
+		{"db.timeout", v.DB.Timeout, 90 * time.Second},
+		{"keep", v.Keep, "keep"},
+	}
+	for _, tc := range cases {
+		if tc.got != tc.want {
+			t.Errorf("%s = %v, want %v", tc.name, tc.got, tc.want)
+		}
+	}
+	// 缺少的配置项以缺省值写入
+	if s, _ := c.GetItem("workers"); s != "4" {
+		t.Errorf("workers item = %q", s)
+	}
+}
+
+func TestConfBindInvalid(t *testing.T) {
+	cases := []struct {
+		text string
+		v    interface{}
+	}{
+		{"port=0x10", &struct {
+			Port int `conf:"port"`
+		}{}},
+		{"n=300", &struct {
+			N uint8 `conf:"n"`
+		}{}},
+		{"t=yesterday", &struct {
+			T time.Time `conf:"t"`
+		}{}},
+		{"d=5x", &struct {
+			D time.Duration `conf:"d"`
+		}{}},
+		{"", struct{}{}},
+	}
+	for _, tc := range cases {
+		c := loadTestConf(t, "bind.conf", tc.text)
+		if err := c.Bind(tc.v); err == nil {
+			t.Errorf("%q: expected error", tc.text)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package gopsu
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	confEncPrefix = "ENC("
+	confEncSuffix = ")"
+)
+
+// SetCryptoKey 设置加密配置项使用的密钥，设置后GetItem自动解密 ENC(...) 格式的值
+//	keyfile，env: 密钥文件和环境变量，参见LoadCryptoKey
+//	已有的加密配置项无法用该密钥解密时返回错误，且不使用该密钥
+func (c *ConfData) SetCryptoKey(keyfile, env string) error {
+	key, err := LoadCryptoKey(keyfile, env)
+	if err != nil {
+		return err
+	}
+	cw := GetNewCryptoWorker(GCMCryptoType(key))
+	if err = cw.SetKey(string(key), ""); err != nil {
+		return err
+	}
+	if err = checkEncryptedItems(cw, c.data()); err != nil {
+		return err
+	}
+	c.cWorker.Store(cw)
+	return nil
+}
+
+// checkEncrypted 已设置密钥时检查重新读取的加密配置项，无法解密时不替换原有配置
+func (c *ConfData) checkEncrypted(m *sync.Map) error {
+	cw, ok := c.cWorker.Load().(*CryptoWorker)
+	if !ok {
+		return nil
+	}
+	return checkEncryptedItems(cw, m)
+}
+
+// checkEncryptedItems 检查m中的加密配置项是否都能解密，返回无法解密的配置项
+func checkEncryptedItems(cw *CryptoWorker, m *sync.Map) error {
+	var bad []string
+	m.Range(func(k, v interface{}) bool {
+		if s := v.(*confItem).value; IsEncryptedValue(s) {
+			if _, err := decryptConfValue(cw, s); err != nil {
+				bad = append(bad, k.(string))
+			}
+		}
+		return true
+	})
+	if len(bad) > 0 {
+		sort.Strings(bad)
+		return fmt.Errorf("conf %s: decrypt failed, wrong key or damaged value", strings.Join(bad, ","))
+	}
+	return nil
+}
+
+// IsEncryptedValue 是否为 ENC(...) 格式的加密值
+func IsEncryptedValue(s string) bool {
+	return strings.HasPrefix(s, confEncPrefix) && strings.HasSuffix(s, confEncSuffix)
+}
+
+// EncryptValue 加密明文，返回 ENC(...) 格式的值，可直接写入配置文件
+func (c *ConfData) EncryptValue(plain string) (string, error) {
+	cw, ok := c.cWorker.Load().(*CryptoWorker)
+	if !ok {
+		return "", fmt.Errorf("no crypto key, call SetCryptoKey first")
+	}
+	return confEncPrefix + cw.Encrypt(plain) + confEncSuffix, nil
+}
+
+// EncryptItem 将配置文件中的明文配置项加密保存，已加密或值为空的配置项不做处理，需调用Save保存到文件
+func (c *ConfData) EncryptItem(keys ...string) error {
+	for _, key := range keys {
+		v, ok := c.data().Load(key)
+		if !ok {
+			return fmt.Errorf("conf %s: key does not exist", key)
+		}
+		item := v.(*confItem)
+		if item.value == "" || IsEncryptedValue(item.value) {
+			continue
+		}
+		s, err := c.EncryptValue(item.value)
+		if err != nil {
+			return err
+		}
+		c.data().Store(key, &confItem{
+			key:    item.key,
+			value:  s,
+			remark: item.remark,
+			seq:    item.seq,
+			src:    item.src,
+		})
+	}
+	return nil
+}
+
+// decryptValue 解密 ENC(...) 格式的值，其他值原样返回，明文可以为空
+func (c *ConfData) decryptValue(s string) (string, error) {
+	if !IsEncryptedValue(s) {
+		return s, nil
+	}
+	cw, ok := c.cWorker.Load().(*CryptoWorker)
+	if !ok {
+		return "", fmt.Errorf("encrypted value but no crypto key")
+	}
+	return decryptConfValue(cw, s)
+}
+
+func decryptConfValue(cw *CryptoWorker, s string) (string, error) {
+	v, err := cw.decryptAEAD(s[len(confEncPrefix) : len(s)-len(confEncSuffix)])
+	if err != nil {
+		return "", fmt.Errorf("decrypt failed, wrong key or damaged value")
+	}
+	return v, nil
+}
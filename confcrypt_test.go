@@ -0,0 +1,82 @@
+package gopsu
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestKey 生成hex编码的密钥文件
+func writeTestKey(t *testing.T, b byte, size int) string {
+	fn := filepath.Join(t.TempDir(), "conf.key")
+	if err := ioutil.WriteFile(fn, []byte(hex.EncodeToString([]byte(strings.Repeat(string(b), size)))), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fn
+}
+
+func TestConfCryptRoundTrip(t *testing.T) {
+	for _, size := range []int{16, 24, 32} {
+		c := loadTestConf(t, "enc.conf", "")
+		if err := c.SetCryptoKey(writeTestKey(t, 'k', size), ""); err != nil {
+			t.Fatal(err)
+		}
+		for _, plain := range []string{"", "secret", "中文 with spaces", strings.Repeat("x", 1000)} {
+			enc, err := c.EncryptValue(plain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !IsEncryptedValue(enc) || (plain != "" && strings.Contains(enc, plain)) {
+				t.Fatalf("EncryptValue(%q) = %q", plain, enc)
+			}
+			c.SetItem("pwd", enc, "")
+			if got, err := c.GetItem("pwd"); err != nil || got != plain {
+				t.Errorf("key %d: GetItem = %q, %v; want %q", size, got, err, plain)
+			}
+			if got := c.GetItemDefault("pwd", "default"); got != plain {
+				t.Errorf("key %d: GetItemDefault = %q, want %q", size, got, plain)
+			}
+		}
+	}
+}
+
+func TestConfCryptWrongKey(t *testing.T) {
+	c := loadTestConf(t, "enc.conf", "")
+	if err := c.SetCryptoKey(writeTestKey(t, 'a', 32), ""); err != nil {
+		t.Fatal(err)
+	}
+	enc, _ := c.EncryptValue("secret")
+	if err := ioutil.WriteFile(c.FullPath(), []byte("pwd="+enc+"\n"), 0664); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConfig(c.FullPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 错误的密钥不会被使用
+	if err := c.SetCryptoKey(writeTestKey(t, 'b', 32), ""); err == nil || !strings.Contains(err.Error(), "pwd") {
+		t.Fatalf("SetCryptoKey with wrong key: %v", err)
+	}
+	if _, err := c.GetItem("pwd"); err == nil {
+		t.Error("GetItem without key should fail")
+	}
+	if got := c.GetItemDefault("pwd", "default"); got == "default" {
+		t.Error("GetItemDefault fell back to the default on a decrypt failure")
+	}
+	if err := c.SetCryptoKey(writeTestKey(t, 'a', 32), ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.GetItem("pwd"); got != "secret" {
+		t.Errorf("GetItem = %q", got)
+	}
+	// 损坏的值不会被重新读取替换
+	ioutil.WriteFile(c.FullPath(), []byte("pwd="+enc[:len(enc)-6]+")\n"), 0664)
+	if err := c.Reload(); err == nil {
+		t.Error("Reload with damaged value should fail")
+	}
+	if got, _ := c.GetItem("pwd"); got != "secret" {
+		t.Errorf("GetItem after failed reload = %q", got)
+	}
+}
@@ -0,0 +1,693 @@
+package gopsu
+
+import (
+	"bytes"
+	stdjson "encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfFormat 配置文件格式
+type ConfFormat byte
+
+const (
+	// ConfFormatKV key=value格式，#开头的行为注释
+	ConfFormatKV ConfFormat = iota
+	// ConfFormatYAML yaml格式
+	ConfFormatYAML
+	// ConfFormatTOML toml格式
+	ConfFormatTOML
+	// ConfFormatJSON json格式
+	ConfFormatJSON
+)
+
+// ConfFormatByExt 按扩展名判断配置文件格式，.yaml/.yml，.toml，.json，其他为key=value格式
+func ConfFormatByExt(fullpath string) ConfFormat {
+	switch strings.ToLower(filepath.Ext(fullpath)) {
+	case ".yaml", ".yml":
+		return ConfFormatYAML
+	case ".toml":
+		return ConfFormatTOML
+	case ".json":
+		return ConfFormatJSON
+	}
+	return ConfFormatKV
+}
+
+// confTree 保持键顺序的嵌套配置
+type confTree struct {
+	keys []string
+	m    map[string]interface{}
+}
+
+func newConfTree() *confTree {
+	return &confTree{m: make(map[string]interface{})}
+}
+
+func (t *confTree) set(k string, v interface{}) {
+	if _, ok := t.m[k]; !ok {
+		t.keys = append(t.keys, k)
+	}
+	t.m[k] = v
+}
+
+// child 获取子节点，不存在或不是子节点时创建
+func (t *confTree) child(k string) *confTree {
+	if c, ok := t.m[k].(*confTree); ok {
+		return c
+	}
+	c := newConfTree()
+	t.set(k, c)
+	return c
+}
+
+// plain 转换为map，用于json编码
+func (t *confTree) plain() map[string]interface{} {
+	m := make(map[string]interface{}, len(t.keys))
+	for _, k := range t.keys {
+		m[k] = confPlainValue(t.m[k])
+	}
+	return m
+}
+
+func confPlainValue(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case *confTree:
+		return vv.plain()
+	case []interface{}:
+		a := make([]interface{}, len(vv))
+		for i, x := range vv {
+			a[i] = confPlainValue(x)
+		}
+		return a
+	}
+	return v
+}
+
+// flatten 按顺序遍历所有值，嵌套的键以.连接
+func (t *confTree) flatten(prefix string, fn func(key string, v interface{})) {
+	for _, k := range t.keys {
+		if c, ok := t.m[k].(*confTree); ok {
+			c.flatten(prefix+k+".", fn)
+			continue
+		}
+		fn(prefix+k, t.m[k])
+	}
+}
+
+// isConfScalar 是否为字符串，数字，布尔等单个值
+func isConfScalar(v interface{}) bool {
+	switch v.(type) {
+	case *confTree, []interface{}, map[string]interface{}, map[interface{}]interface{}:
+		return false
+	}
+	return true
+}
+
+// confValueString 将值转换为配置项字符串，简单数组以逗号连接，其他数组使用json
+func confValueString(v interface{}) string {
+	switch vv := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return vv
+	case float64:
+		return strconv.FormatFloat(vv, 'f', -1, 64)
+	case time.Time:
+		return vv.Format(tomlTimeLayout(vv))
+	case []interface{}:
+		ss := make([]string, len(vv))
+		for i, x := range vv {
+			if !isConfScalar(x) {
+				b, _ := stdjson.Marshal(confPlainValue(vv))
+				return string(b)
+			}
+			ss[i] = confValueString(x)
+		}
+		return strings.Join(ss, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+// confTypedValue 按文件中原有的类型转换配置项的值，无法转换或新配置项时使用字符串
+func confTypedValue(s string, orig interface{}) interface{} {
+	switch ov := orig.(type) {
+	case bool:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	case int, int64, uint64, stdjson.Number:
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case float64:
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case time.Time:
+		if t, err := time.ParseInLocation(tomlTimeLayout(ov), s, ov.Location()); err == nil {
+			return t
+		}
+	case []interface{}:
+		for _, x := range ov {
+			if !isConfScalar(x) {
+				var a []interface{}
+				dec := stdjson.NewDecoder(strings.NewReader(s))
+				dec.UseNumber()
+				if err := dec.Decode(&a); err == nil {
+					return a
+				}
+				return s
+			}
+		}
+		a := make([]interface{}, 0)
+		if s == "" {
+			return a
+		}
+		var eo interface{}
+		if len(ov) > 0 {
+			eo = ov[0]
+		}
+		for _, x := range strings.Split(s, ",") {
+			a = append(a, confTypedValue(TrimString(x), eo))
+		}
+		return a
+	}
+	return s
+}
+
+// parseFormat 解析yaml，toml，json格式的配置
+func (c *ConfData) parseFormat(data []byte) (*sync.Map, error) {
+	var t *confTree
+	var remarks map[string]string
+	var err error
+	switch c.format {
+	case ConfFormatYAML:
+		t, err = decodeConfYAML(data)
+	case ConfFormatJSON:
+		t, err = decodeConfJSON(data)
+	case ConfFormatTOML:
+		t, remarks, err = decodeConfTOML(string(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+	m := &sync.Map{}
+	t.flatten("", func(key string, v interface{}) {
+		m.Store(key, &confItem{
+			key:    key,
+			value:  confValueString(v),
+			remark: remarks[key],
+			seq:    atomic.AddUint64(&c.seq, 1),
+			orig:   v,
+			src:    ConfSourceFile,
+		})
+	})
+	return m, nil
+}
+
+// encodeFormat 生成yaml，toml，json格式的配置，配置项按读取和添加的顺序排列
+func (c *ConfData) encodeFormat() ([]byte, error) {
+	var ss = make([]*confItem, 0)
+	c.data().Range(func(k, v interface{}) bool {
+		ss = append(ss, v.(*confItem))
+		return true
+	})
+	sort.Slice(ss, func(i, j int) bool {
+		return ss[i].seq < ss[j].seq
+	})
+	t := newConfTree()
+	remarks := make(map[string]string)
+	for _, item := range ss {
+		keys := strings.Split(item.key, ".")
+		n := t
+		for _, k := range keys[:len(keys)-1] {
+			n = n.child(k)
+		}
+		n.set(keys[len(keys)-1], confTypedValue(item.value, item.orig))
+		remarks[item.key] = item.remark
+	}
+	switch c.format {
+	case ConfFormatYAML:
+		return yaml.Marshal(confYAMLValue(t))
+	case ConfFormatJSON:
+		var b bytes.Buffer
+		writeConfJSON(&b, t, "")
+		b.WriteByte('\n')
+		return b.Bytes(), nil
+	case ConfFormatTOML:
+		var b bytes.Buffer
+		writeConfTOML(&b, t, "", remarks)
+		return b.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown config format")
+}
+
+// decodeConfYAML 解析yaml，保持键的顺序
+func decodeConfYAML(data []byte) (*confTree, error) {
+	var ms yaml.MapSlice
+	if err := yaml.Unmarshal(data, &ms); err != nil {
+		return nil, err
+	}
+	return confTreeFromYAML(ms), nil
+}
+
+func confTreeFromYAML(ms yaml.MapSlice) *confTree {
+	t := newConfTree()
+	for _, item := range ms {
+		t.set(fmt.Sprint(item.Key), confFromYAMLValue(item.Value))
+	}
+	return t
+}
+
+func confFromYAMLValue(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case yaml.MapSlice:
+		return confTreeFromYAML(vv)
+	case []interface{}:
+		a := make([]interface{}, len(vv))
+		for i, x := range vv {
+			a[i] = confFromYAMLValue(x)
+		}
+		return a
+	}
+	return v
+}
+
+// confYAMLValue 转换为yaml.MapSlice以保持键的顺序
+func confYAMLValue(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case *confTree:
+		ms := make(yaml.MapSlice, 0, len(vv.keys))
+		for _, k := range vv.keys {
+			ms = append(ms, yaml.MapItem{Key: k, Value: confYAMLValue(vv.m[k])})
+		}
+		return ms
+	case []interface{}:
+		a := make([]interface{}, len(vv))
+		for i, x := range vv {
+			a[i] = confYAMLValue(x)
+		}
+		return a
+	}
+	return v
+}
+
+// decodeConfJSON 解析json，保持键的顺序
+func decodeConfJSON(data []byte) (*confTree, error) {
+	dec := stdjson.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := decodeConfJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := v.(*confTree)
+	if !ok {
+		return nil, fmt.Errorf("json config must be an object")
+	}
+	return t, nil
+}
+
+func decodeConfJSONValue(dec *stdjson.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case stdjson.Delim('{'):
+		t := newConfTree()
+		for dec.More() {
+			kt, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeConfJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			t.set(fmt.Sprint(kt), v)
+		}
+		_, err = dec.Token()
+		return t, err
+	case stdjson.Delim('['):
+		a := make([]interface{}, 0)
+		for dec.More() {
+			v, err := decodeConfJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		_, err = dec.Token()
+		return a, err
+	}
+	return tok, nil
+}
+
+// writeConfJSON 按顺序输出json，缩进2个空格
+func writeConfJSON(b *bytes.Buffer, v interface{}, indent string) {
+	switch vv := v.(type) {
+	case *confTree:
+		if len(vv.keys) == 0 {
+			b.WriteString("{}")
+			return
+		}
+		b.WriteString("{\n")
+		for i, k := range vv.keys {
+			kb, _ := stdjson.Marshal(k)
+			b.WriteString(indent + "  ")
+			b.Write(kb)
+			b.WriteString(": ")
+			writeConfJSON(b, vv.m[k], indent+"  ")
+			if i < len(vv.keys)-1 {
+				b.WriteByte(',')
+			}
+			b.WriteByte('\n')
+		}
+		b.WriteString(indent + "}")
+	case []interface{}:
+		if len(vv) == 0 {
+			b.WriteString("[]")
+			return
+		}
+		b.WriteString("[\n")
+		for i, x := range vv {
+			b.WriteString(indent + "  ")
+			writeConfJSON(b, x, indent+"  ")
+			if i < len(vv)-1 {
+				b.WriteByte(',')
+			}
+			b.WriteByte('\n')
+		}
+		b.WriteString(indent + "]")
+	default:
+		vb, err := stdjson.Marshal(v)
+		if err != nil {
+			vb, _ = stdjson.Marshal(fmt.Sprint(v))
+		}
+		b.Write(vb)
+	}
+}
+
+// tomlBareKey 不需要引号的toml键
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func tomlKey(k string) string {
+	if tomlBareKey.MatchString(k) {
+		return k
+	}
+	return strconv.Quote(k)
+}
+
+// hasValue 是否包含子表以外的值
+func (t *confTree) hasValue() bool {
+	for _, k := range t.keys {
+		if _, ok := t.m[k].(*confTree); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// tomlTableName 点分路径转换为表名，各段按需加引号
+func tomlTableName(path string) string {
+	keys := strings.Split(path, ".")
+	for i, k := range keys {
+		keys[i] = tomlKey(k)
+	}
+	return strings.Join(keys, ".")
+}
+
+// writeConfTOML 输出toml，先输出当前表的值，再输出子表，配置项说明作为注释写在键的上方
+func writeConfTOML(b *bytes.Buffer, t *confTree, path string, remarks map[string]string) {
+	for _, k := range t.keys {
+		v := t.m[k]
+		if _, ok := v.(*confTree); ok {
+			continue
+		}
+		for _, r := range formatConfRemark(remarks[path+k]) {
+			b.WriteString(r + "\n")
+		}
+		b.WriteString(tomlKey(k) + " = ")
+		writeTOMLValue(b, v)
+		b.WriteByte('\n')
+	}
+	for _, k := range t.keys {
+		c, ok := t.m[k].(*confTree)
+		if !ok {
+			continue
+		}
+		// 只包含子表的表不输出表头
+		if c.hasValue() || len(c.keys) == 0 {
+			if b.Len() > 0 {
+				b.WriteByte('\n')
+			}
+			b.WriteString("[" + tomlTableName(path+k) + "]\n")
+		}
+		writeConfTOML(b, c, path+k+".", remarks)
+	}
+}
+
+func writeTOMLValue(b *bytes.Buffer, v interface{}) {
+	switch vv := v.(type) {
+	case nil:
+		b.WriteString(`""`)
+	case string:
+		b.WriteString(tomlQuote(vv))
+	case bool:
+		b.WriteString(strconv.FormatBool(vv))
+	case float64:
+		s := strconv.FormatFloat(vv, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEnN") {
+			s += ".0"
+		}
+		b.WriteString(s)
+	case int, int64, uint64, stdjson.Number:
+		b.WriteString(fmt.Sprint(vv))
+	case time.Time:
+		b.WriteString(vv.Format(tomlTimeLayout(vv)))
+	case []interface{}:
+		b.WriteByte('[')
+		for i, x := range vv {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeTOMLValue(b, x)
+		}
+		b.WriteByte(']')
+	case *confTree:
+		b.WriteByte('{')
+		for i, k := range vv.keys {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(tomlKey(k) + " = ")
+			writeTOMLValue(b, vv.m[k])
+		}
+		b.WriteByte('}')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(vv))
+		for k := range vv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(tomlKey(k) + " = ")
+			writeTOMLValue(b, vv[k])
+		}
+		b.WriteByte('}')
+	default:
+		b.WriteString(tomlQuote(fmt.Sprint(vv)))
+	}
+}
+
+// tomlQuote toml基本字符串，只使用toml支持的转义
+func tomlQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				b.WriteString(fmt.Sprintf(`\u%04X`, r))
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// decodeConfTOML 解析toml，按文件中的顺序保存键，键上方紧邻的注释作为说明
+func decodeConfTOML(data string) (*confTree, map[string]string, error) {
+	var m map[string]interface{}
+	md, err := toml.Decode(data, &m)
+	if err != nil {
+		return nil, nil, err
+	}
+	root := newConfTree()
+	for _, key := range md.Keys() {
+		v, ok := tomlLookup(m, key)
+		if !ok {
+			continue
+		}
+		n := root
+		for _, k := range key[:len(key)-1] {
+			n = n.child(k)
+		}
+		last := key[len(key)-1]
+		// 表中的键在之后按顺序写入
+		if _, ok := v.(map[string]interface{}); ok {
+			n.child(last)
+			continue
+		}
+		n.set(last, confFromTOMLValue(v))
+	}
+	return root, tomlRemarks(data), nil
+}
+
+// tomlLookup 按键路径取值，数组表中的键随数组一起处理，返回false
+func tomlLookup(m map[string]interface{}, key toml.Key) (interface{}, bool) {
+	var v interface{} = m
+	for _, k := range key {
+		t, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = t[k]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// confFromTOMLValue 将数组表转换为[]interface{}，与其他格式的数组一致
+func confFromTOMLValue(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case []map[string]interface{}:
+		a := make([]interface{}, len(vv))
+		for i, x := range vv {
+			a[i] = confFromTOMLValue(x)
+		}
+		return a
+	case []interface{}:
+		a := make([]interface{}, len(vv))
+		for i, x := range vv {
+			a[i] = confFromTOMLValue(x)
+		}
+		return a
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(vv))
+		for k, x := range vv {
+			m[k] = confFromTOMLValue(x)
+		}
+		return m
+	}
+	return v
+}
+
+// tomlTimeLayout toml日期时间的格式，本地日期时间，日期和时间不带时区
+func tomlTimeLayout(t time.Time) string {
+	switch t.Location().String() {
+	case "datetime-local":
+		return "2006-01-02T15:04:05.999999999"
+	case "date-local":
+		return "2006-01-02"
+	case "time-local":
+		return "15:04:05.999999999"
+	}
+	return time.RFC3339Nano
+}
+
+// tomlRemarks 读取键上方紧邻的注释作为说明，数组表中的键不记录
+func tomlRemarks(data string) map[string]string {
+	remarks := make(map[string]string)
+	comments := make([]string, 0)
+	path, inArray := "", false
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#"):
+			comments = append(comments, line)
+			continue
+		case strings.HasPrefix(line, "[["):
+			inArray = true
+		case strings.HasPrefix(line, "["):
+			if end := strings.Index(line, "]"); end > 0 {
+				path, inArray = strings.Join(tomlSplitKey(line[1:end]), ".")+".", false
+			}
+		default:
+			if i := strings.Index(line, "="); i > 0 && !inArray && len(comments) > 0 {
+				remarks[path+strings.Join(tomlSplitKey(line[:i]), ".")] = strings.Join(comments, "\n")
+			}
+		}
+		comments = comments[:0]
+	}
+	return remarks
+}
+
+// tomlSplitKey 拆分点分键，去掉引号
+func tomlSplitKey(s string) []string {
+	keys := make([]string, 0)
+	var quote byte
+	start := 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) {
+			c := s[i]
+			if quote != 0 {
+				if c == quote && (quote == '\'' || s[i-1] != '\\') {
+					quote = 0
+				}
+				continue
+			}
+			if c == '"' || c == '\'' {
+				quote = c
+				continue
+			}
+			if c != '.' {
+				continue
+			}
+		}
+		k := strings.TrimSpace(s[start:i])
+		switch {
+		case strings.HasPrefix(k, "'"):
+			k = strings.Trim(k, "'")
+		case strings.HasPrefix(k, `"`):
+			if u, err := strconv.Unquote(k); err == nil {
+				k = u
+			}
+		}
+		keys = append(keys, k)
+		start = i + 1
+	}
+	return keys
+}
@@ -0,0 +1,95 @@
+package gopsu
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfTOML = `# 服务名称
+name = "svc"
+port = 8080
+ratio = 0.5
+debug = true
+ts = 1979-05-27T07:32:00Z
+day = 1979-05-27
+local = 1979-05-27T07:32:00
+at = 07:32:00
+tags = ["a", "b"]
+
+[db]
+# 数据库地址
+server = "127.0.0.1:3306"
+timeout = 5
+
+[[hosts]]
+ip = "10.0.0.1"
+`
+
+func TestConfTOMLRoundTrip(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "conf.toml")
+	if err := ioutil.WriteFile(fn, []byte(testConfTOML), 0664); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConfig(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"name":       "svc",
+		"port":       "8080",
+		"ratio":      "0.5",
+		"debug":      "true",
+		"ts":         "1979-05-27T07:32:00Z",
+		"day":        "1979-05-27",
+		"local":      "1979-05-27T07:32:00",
+		"at":         "07:32:00",
+		"tags":       "a,b",
+		"db.server":  "127.0.0.1:3306",
+		"db.timeout": "5",
+	}
+	for k, v := range want {
+		if s, _ := c.GetItem(k); s != v {
+			t.Errorf("%s = %q, want %q", k, s, v)
+		}
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(fn)
+	out := string(b)
+	for _, line := range []string{
+		"# 服务名称\nname = \"svc\"",
+		"ts = 1979-05-27T07:32:00Z",
+		"day = 1979-05-27",
+		"local = 1979-05-27T07:32:00",
+		"at = 07:32:00",
+		"# 数据库地址\nserver = \"127.0.0.1:3306\"",
+		"timeout = 5",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("saved toml missing %q:\n%s", line, out)
+		}
+	}
+	// 保存后再次读取，值不变
+	c2, err := LoadConfig(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range want {
+		if s, _ := c2.GetItem(k); s != v {
+			t.Errorf("reload %s = %q, want %q", k, s, v)
+		}
+	}
+}
+
+func TestConfTOMLInvalid(t *testing.T) {
+	for _, s := range []string{"n = 010", "a = ", "[x\nb = 1"} {
+		fn := filepath.Join(t.TempDir(), "conf.toml")
+		ioutil.WriteFile(fn, []byte(s), 0664)
+		if _, err := LoadConfig(fn); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package gopsu
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ConfSource 配置项的值的来源
+type ConfSource byte
+
+const (
+	// ConfSourceNone 配置项不存在
+	ConfSourceNone ConfSource = iota
+	// ConfSourceDefault 程序内置的缺省值，由GetItemDefault或Bind添加
+	ConfSourceDefault
+	// ConfSourceFile 配置文件，或由SetItem设置
+	ConfSourceFile
+	// ConfSourceEnv 环境变量
+	ConfSourceEnv
+	// ConfSourceFlag 命令行参数
+	ConfSourceFlag
+)
+
+func (s ConfSource) String() string {
+	switch s {
+	case ConfSourceDefault:
+		return "default"
+	case ConfSourceFile:
+		return "file"
+	case ConfSourceEnv:
+		return "env"
+	case ConfSourceFlag:
+		return "flag"
+	}
+	return "none"
+}
+
+// SetEnvPrefix 开启环境变量覆盖，环境变量的值优先于配置文件
+//	环境变量名称为 前缀_配置项名称，配置项名称转为大写，非字母数字的字符替换为_，如 APP 和 db.server 对应 APP_DB_SERVER
+//	prefix不能为空，避免path，home等配置项被PATH，HOME等系统环境变量覆盖
+func (c *ConfData) SetEnvPrefix(prefix string) error {
+	prefix = TrimString(prefix)
+	if strings.Trim(prefix, "_") == "" {
+		return fmt.Errorf("env prefix must not be empty")
+	}
+	if !strings.HasSuffix(prefix, "_") {
+		prefix += "_"
+	}
+	c.envPrefix.Store(prefix)
+	return nil
+}
+
+// EnvName 配置项对应的环境变量名称，未开启环境变量覆盖时返回空字符串
+func (c *ConfData) EnvName(key string) string {
+	prefix, ok := c.envPrefix.Load().(string)
+	if !ok || prefix == "" {
+		return ""
+	}
+	return prefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, TrimString(key))
+}
+
+// SetOverride 设置命令行参数的值，优先于环境变量和配置文件，不会保存到配置文件
+func (c *ConfData) SetOverride(key, value string) {
+	c.overrides.Store(TrimString(key), TrimString(value))
+}
+
+// DelOverride 删除命令行参数的值
+func (c *ConfData) DelOverride(key string) {
+	c.overrides.Delete(TrimString(key))
+}
+
+// SetFlagOverrides 将命令行中指定了的参数作为同名配置项的值，需在fs.Parse之后调用
+//	fs: 为nil时使用flag.CommandLine
+func (c *ConfData) SetFlagOverrides(fs *flag.FlagSet) {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+	fs.Visit(func(f *flag.Flag) {
+		c.SetOverride(f.Name, f.Value.String())
+	})
+}
+
+// Source 配置项的值的来源
+func (c *ConfData) Source(key string) ConfSource {
+	if _, src := c.override(key); src != ConfSourceNone {
+		return src
+	}
+	if v, ok := c.data().Load(key); ok {
+		return v.(*confItem).src
+	}
+	return ConfSourceNone
+}
+
+// override 查找命令行参数和环境变量中的值
+func (c *ConfData) override(key string) (string, ConfSource) {
+	if v, ok := c.overrides.Load(key); ok {
+		return v.(string), ConfSourceFlag
+	}
+	if name := c.EnvName(key); name != "" {
+		if v, ok := os.LookupEnv(name); ok {
+			return TrimString(v), ConfSourceEnv
+		}
+	}
+	return "", ConfSourceNone
+}
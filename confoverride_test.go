@@ -0,0 +1,75 @@
+package gopsu
+
+import (
+	"flag"
+	"os"
+	"testing"
+)
+
+func TestConfOverridePrecedence(t *testing.T) {
+	c := loadTestConf(t, "app.conf", "db.server=file\nport=1\nname=file\n")
+	if err := c.SetEnvPrefix("GOPSUTEST"); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{"GOPSUTEST_DB_SERVER": "env", "GOPSUTEST_PORT": "2", "GOPSUTEST_TIMEOUT": "30"} {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("port", "0", "")
+	fs.String("name", "unset", "")
+	fs.Parse([]string{"-port=3"})
+	c.SetFlagOverrides(fs)
+
+	cases := []struct {
+		key  string
+		def  string
+		want string
+		src  ConfSource
+	}{
+		{"db.server", "def", "env", ConfSourceEnv},
+		{"port", "def", "3", ConfSourceFlag},
+		// 未在命令行中指定的参数不覆盖
+		{"name", "def", "file", ConfSourceFile},
+		{"timeout", "def", "30", ConfSourceEnv},
+		{"missing", "def", "def", ConfSourceDefault},
+	}
+	for _, tc := range cases {
+		if v := c.GetItemDefault(tc.key, tc.def); v != tc.want {
+			t.Errorf("%s = %q, want %q", tc.key, v, tc.want)
+		}
+		if src := c.Source(tc.key); src != tc.src {
+			t.Errorf("%s source = %s, want %s", tc.key, src, tc.src)
+		}
+	}
+	c.DelOverride("port")
+	if v, _ := c.GetItem("port"); v != "2" {
+		t.Errorf("port after DelOverride = %q", v)
+	}
+}
+
+func TestConfEnvPrefix(t *testing.T) {
+	c := loadTestConf(t, "app.conf", "path=/data\n")
+	cases := []struct {
+		prefix string
+		ok     bool
+		env    string
+	}{
+		{"", false, ""},
+		{"__", false, ""},
+		{"APP", true, "APP_PATH"},
+		{"APP_", true, "APP_PATH"},
+	}
+	for _, tc := range cases {
+		err := c.SetEnvPrefix(tc.prefix)
+		if (err == nil) != tc.ok {
+			t.Errorf("SetEnvPrefix(%q) = %v", tc.prefix, err)
+		}
+		if name := c.EnvName("path"); name != tc.env {
+			t.Errorf("prefix %q: EnvName = %q, want %q", tc.prefix, name, tc.env)
+		}
+	}
+	if name := c.EnvName("db.server-1"); name != "APP_DB_SERVER_1" {
+		t.Errorf("EnvName = %q", name)
+	}
+}
@@ -0,0 +1,167 @@
+package gopsu
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// confWatcher 配置变化订阅
+type confWatcher struct {
+	locker sync.RWMutex
+	seq    uint64
+	subs   map[string][]*confSub
+	any    []*confSub
+}
+
+// confSub 单个订阅，id用于取消
+type confSub struct {
+	id uint64
+	fn func(key, old, new string)
+}
+
+// confChange 重新读取后变化的配置项
+type confChange struct {
+	key      string
+	old, new string
+}
+
+// OnChange 订阅配置项变化，Reload后配置项的值改变时调用fn，新增的配置项old为空，删除的配置项new为空
+//	返回取消订阅的函数
+func (c *ConfData) OnChange(key string, fn func(old, new string)) func() {
+	c.watcher.locker.Lock()
+	defer c.watcher.locker.Unlock()
+	if c.watcher.subs == nil {
+		c.watcher.subs = make(map[string][]*confSub)
+	}
+	c.watcher.seq++
+	sub := &confSub{id: c.watcher.seq, fn: func(_, old, new string) { fn(old, new) }}
+	c.watcher.subs[key] = append(c.watcher.subs[key], sub)
+	return func() {
+		c.watcher.locker.Lock()
+		defer c.watcher.locker.Unlock()
+		c.watcher.subs[key] = removeConfSub(c.watcher.subs[key], sub.id)
+		if len(c.watcher.subs[key]) == 0 {
+			delete(c.watcher.subs, key)
+		}
+	}
+}
+
+// OnAnyChange 订阅所有配置项的变化，参数同OnChange，key为变化的配置项名称
+//	返回取消订阅的函数
+func (c *ConfData) OnAnyChange(fn func(key, old, new string)) func() {
+	c.watcher.locker.Lock()
+	defer c.watcher.locker.Unlock()
+	c.watcher.seq++
+	sub := &confSub{id: c.watcher.seq, fn: fn}
+	c.watcher.any = append(c.watcher.any, sub)
+	return func() {
+		c.watcher.locker.Lock()
+		defer c.watcher.locker.Unlock()
+		c.watcher.any = removeConfSub(c.watcher.any, sub.id)
+	}
+}
+
+// removeConfSub 返回去掉id之后的新切片，不修改原切片，通知过程中可安全取消订阅
+func removeConfSub(subs []*confSub, id uint64) []*confSub {
+	ss := make([]*confSub, 0, len(subs))
+	for _, sub := range subs {
+		if sub.id != id {
+			ss = append(ss, sub)
+		}
+	}
+	return ss
+}
+
+// replaceItems 替换全部配置项并通知订阅者，替换前后GetItem始终能读到完整的配置
+func (c *ConfData) replaceItems(m *sync.Map) {
+	c.locker.Lock()
+	old := c.data()
+	c.items.Store(m)
+	c.locker.Unlock()
+
+	c.watcher.locker.RLock()
+	subs, all := c.watcher.subs, c.watcher.any
+	if len(subs) == 0 && len(all) == 0 {
+		c.watcher.locker.RUnlock()
+		return
+	}
+	var changes = make([]*confChange, 0)
+	m.Range(func(k, v interface{}) bool {
+		nv := v.(*confItem).value
+		if ov, ok := old.Load(k); !ok || ov.(*confItem).value != nv {
+			ch := &confChange{key: k.(string), new: nv}
+			if ok {
+				ch.old = ov.(*confItem).value
+			}
+			changes = append(changes, ch)
+		}
+		return true
+	})
+	old.Range(func(k, v interface{}) bool {
+		if _, ok := m.Load(k); !ok {
+			changes = append(changes, &confChange{key: k.(string), old: v.(*confItem).value})
+		}
+		return true
+	})
+	type call struct {
+		fn func(key, old, new string)
+		ch *confChange
+	}
+	calls := make([]call, 0)
+	for _, ch := range changes {
+		for _, sub := range subs[ch.key] {
+			calls = append(calls, call{sub.fn, ch})
+		}
+		for _, sub := range all {
+			calls = append(calls, call{sub.fn, ch})
+		}
+	}
+	// 释放锁后再通知，订阅函数中可以订阅或取消订阅
+	c.watcher.locker.RUnlock()
+	for _, cl := range calls {
+		callConfChange(cl.fn, cl.ch)
+	}
+}
+
+// callConfChange 调用订阅函数，忽略其中的panic
+func callConfChange(fn func(key, old, new string), ch *confChange) {
+	defer func() { recover() }()
+	fn(ch.key, ch.old, ch.new)
+}
+
+// Watch 定时检查配置文件，文件修改后重新读取，并通知OnChange的订阅者，ctx结束后停止
+//	interval: 检查间隔，默认3s，最小1s
+func (c *ConfData) Watch(ctx context.Context, interval ...time.Duration) {
+	var d = time.Second * 3
+	if len(interval) > 0 {
+		d = interval[0]
+	}
+	if d < time.Second {
+		d = time.Second
+	}
+	var modTime time.Time
+	var size int64
+	if fi, err := os.Stat(c.FullPath()); err == nil {
+		modTime, size = fi.ModTime(), fi.Size()
+	}
+	go func() {
+		t := time.NewTicker(d)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			fi, err := os.Stat(c.FullPath())
+			if err != nil || (fi.ModTime().Equal(modTime) && fi.Size() == size) {
+				continue
+			}
+			if c.Reload() == nil {
+				modTime, size = fi.ModTime(), fi.Size()
+			}
+		}
+	}()
+}
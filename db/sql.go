@@ -46,12 +46,16 @@ func qdUnmarshal(b []byte) *QueryData {
 
 type QueryDataRow struct {
 	Cells []string `json:"cells,omitempty"`
+	// 值为NULL的字段序号，仅在启用ColumnMeta时填充
+	Nulls []int32 `json:"nulls,omitempty"`
 }
 type QueryData struct {
 	Total    int32           `json:"total,omitempty"`
 	CacheTag string          `json:"cache_tag,omitempty"`
 	Rows     []*QueryDataRow `json:"rows,omitempty"`
 	Columns  []string        `json:"columns,omitempty"`
+	// 字段的数据库类型名称，如INT，VARCHAR，仅在启用ColumnMeta时填充
+	ColumnTypes []string `json:"column_types,omitempty"`
 }
 
 // driveType 数据库驱动类型
@@ -84,6 +88,14 @@ type SQLInterface interface {
 	Exec(string, ...interface{}) (int64, int64, error)
 	ExecPrepare(string, int, ...interface{}) error
 	ExecBatch([]string) error
+	QueryOneContext(context.Context, string, int, ...interface{}) (string, error)
+	QueryPB2Context(context.Context, string, int, ...interface{}) (*QueryData, error)
+	QueryJSONContext(context.Context, string, int, ...interface{}) (string, error)
+	ExecContext(context.Context, string, ...interface{}) (int64, int64, error)
+	ExecPrepareContext(context.Context, string, int, ...interface{}) error
+	ExecBatchContext(context.Context, []string) error
+	Tx(context.Context, func(*SQLTx) error, ...*sql.TxOptions) error
+	QueryIter(context.Context, string, ...interface{}) (*RowIter, error)
 }
 
 // SQLPool 数据库连接池
@@ -100,8 +112,12 @@ type SQLPool struct {
 	DriverType driveType
 	// IO超时(秒)
 	Timeout int
+	// 流式查询（QueryIter，QueryStream）的超时(秒)，0-只受调用方ctx控制，不使用Timeout
+	StreamTimeout int
 	// 最大连接数
 	MaxOpenConns int
+	// 最大并发查询数，0-不限制，仅受MaxOpenConns约束
+	MaxConcurrent int
 	// 日志
 	Logger gopsu.Logger
 	// 是否启用缓存功能，缓存30分钟有效
@@ -110,11 +126,14 @@ type SQLPool struct {
 	CacheDir string
 	// 缓存文件前缀
 	CacheHead string
+	// 查询结果是否附带字段类型和NULL标记
+	ColumnMeta bool
 	// connPool 数据库连接池
 	connPool *sql.DB
-	// 查询锁
-	queryLocker sync.Mutex
-	execLocker  sync.Mutex
+	// limiter 并发查询限制
+	limiter chan struct{}
+	// 执行锁
+	execLocker sync.Mutex
 }
 
 // New 初始化
@@ -128,6 +147,12 @@ func (p *SQLPool) New() error {
 	if p.MaxOpenConns < 20 || p.MaxOpenConns > 500 {
 		p.MaxOpenConns = 100
 	}
+	if p.MaxConcurrent < 0 {
+		p.MaxConcurrent = 0
+	}
+	if p.MaxConcurrent > 0 {
+		p.limiter = make(chan struct{}, p.MaxConcurrent)
+	}
 	if p.CacheDir == "" {
 		p.CacheDir = gopsu.DefaultCacheDir
 	}
@@ -219,6 +244,26 @@ func (p *SQLPool) IsReady() bool {
 
 }
 
+// acquire 获取查询许可，未设置MaxConcurrent时不限制，等待期间ctx结束则返回错误
+func (p *SQLPool) acquire(ctx context.Context) error {
+	if p.limiter == nil {
+		return nil
+	}
+	select {
+	case p.limiter <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release 释放查询许可
+func (p *SQLPool) release() {
+	if p.limiter != nil {
+		<-p.limiter
+	}
+}
+
 // checkSQL 检查sql语句是否存在注入攻击风险
 //
 // args：
@@ -362,16 +407,23 @@ func (p *SQLPool) QueryCacheMultirowPage(cacheTag string, startRow, rowsCount, k
 // return:
 //  结果集json字符串，error
 func (p *SQLPool) QueryOne(s string, colNum int, params ...interface{}) (js string, err error) {
-	defer func() (string, error) {
+	return p.QueryOneContext(context.Background(), s, colNum, params...)
+}
+
+// QueryOneContext 同QueryOne，ctx取消或超过Timeout时中止执行
+func (p *SQLPool) QueryOneContext(ctx context.Context, s string, colNum int, params ...interface{}) (js string, err error) {
+	defer func() {
 		if ex := recover(); ex != nil {
-			err = ex.(error)
-			return "", err
+			js, err = "", fmt.Errorf("%v", ex)
 		}
-		return js, nil
 	}()
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(p.Timeout))
+	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(p.Timeout))
 	defer cancel()
+	if err := p.acquire(ctx); err != nil {
+		return js, err
+	}
+	defer p.release()
 	row := p.connPool.QueryRowContext(ctx, s, params...)
 	if err != nil {
 		return js, err
@@ -413,8 +465,13 @@ func (p *SQLPool) QueryOne(s string, colNum int, params ...interface{}) (js stri
 // return:
 //  QueryData结构，error
 func (p *SQLPool) QueryLimit(s string, startRow, rowsCount int, params ...interface{}) (*QueryData, error) {
+	return p.QueryLimitContext(context.Background(), s, startRow, rowsCount, params...)
+}
+
+// QueryLimitContext 同QueryLimit，ctx取消或超过Timeout时中止执行
+func (p *SQLPool) QueryLimitContext(ctx context.Context, s string, startRow, rowsCount int, params ...interface{}) (*QueryData, error) {
 	if startRow+rowsCount == 0 {
-		return p.QueryPB2(s, rowsCount, params...)
+		return p.QueryPB2Context(ctx, s, rowsCount, params...)
 	}
 	switch p.DriverType {
 	case DriverMSSQL:
@@ -422,7 +479,7 @@ func (p *SQLPool) QueryLimit(s string, startRow, rowsCount int, params ...interf
 	case DriverMYSQL:
 		s += fmt.Sprintf(" limit %d,%d", startRow, rowsCount)
 	}
-	query, err := p.QueryPB2(s, 0, params...)
+	query, err := p.QueryPB2Context(ctx, s, 0, params...)
 	if err != nil {
 		return nil, err
 	}
@@ -440,13 +497,18 @@ func (p *SQLPool) QueryLimit(s string, startRow, rowsCount int, params ...interf
 // return:
 //  QueryData结构，error
 func (p *SQLPool) QueryPB2Big(s string, startRow, rowsCount int, params ...interface{}) (*QueryData, error) {
+	return p.QueryPB2BigContext(context.Background(), s, startRow, rowsCount, params...)
+}
+
+// QueryPB2BigContext 同QueryPB2Big，ctx取消或超过Timeout时中止执行
+func (p *SQLPool) QueryPB2BigContext(ctx context.Context, s string, startRow, rowsCount int, params ...interface{}) (*QueryData, error) {
 	ss := strings.Replace(s, "select ", "select count(*),", 1)
-	queryCount, err := p.QueryPB2(ss, 1, params...)
+	queryCount, err := p.QueryPB2Context(ctx, ss, 1, params...)
 	if err != nil {
 		p.Logger.Error("QueryPB2New Err: " + err.Error())
-		return p.QueryPB2(s, rowsCount, params...)
+		return p.QueryPB2Context(ctx, s, rowsCount, params...)
 	}
-	query, err := p.QueryLimit(s, startRow, rowsCount, params...)
+	query, err := p.QueryLimitContext(ctx, s, startRow, rowsCount, params...)
 	query.Total = gopsu.String2Int32(queryCount.Rows[0].Cells[0], 10)
 	return query, err
 }
@@ -460,7 +522,12 @@ func (p *SQLPool) QueryPB2Big(s string, startRow, rowsCount int, params ...inter
 // return:
 //  结果集json字符串，error
 func (p *SQLPool) QueryJSON(s string, rowsCount int, params ...interface{}) (string, error) {
-	x, ex := p.QueryPB2(s, rowsCount, params...)
+	return p.QueryJSONContext(context.Background(), s, rowsCount, params...)
+}
+
+// QueryJSONContext 同QueryJSON，ctx取消或超过Timeout时中止执行
+func (p *SQLPool) QueryJSONContext(ctx context.Context, s string, rowsCount int, params ...interface{}) (string, error) {
+	x, ex := p.QueryPB2Context(ctx, s, rowsCount, params...)
 	if ex != nil {
 		return "", ex
 	}
@@ -476,32 +543,72 @@ func (p *SQLPool) QueryJSON(s string, rowsCount int, params ...interface{}) (str
 // return:
 //  QueryData结构，error
 func (p *SQLPool) QueryPB2(s string, rowsCount int, params ...interface{}) (query *QueryData, err error) {
-	p.queryLocker.Lock()
-	defer func() (*QueryData, error) {
+	return p.QueryPB2Context(context.Background(), s, rowsCount, params...)
+}
+
+// QueryPB2Context 同QueryPB2，ctx取消或超过Timeout时中止执行
+func (p *SQLPool) QueryPB2Context(ctx context.Context, s string, rowsCount int, params ...interface{}) (query *QueryData, err error) {
+	defer func() {
 		if ex := recover(); ex != nil {
-			err = ex.(error)
-			return nil, err
+			query, err = nil, fmt.Errorf("%v", ex)
 		}
-		p.queryLocker.Unlock()
-		return query, err
 	}()
 
 	query = &QueryData{}
-	queryCache := &QueryData{}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(p.Timeout))
+	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(p.Timeout))
 	defer cancel()
+	if err := p.acquire(ctx); err != nil {
+		return query, err
+	}
+	defer p.release()
 	rows, err := p.connPool.QueryContext(ctx, s, params...)
 	if err != nil {
 		return query, err
 	}
 	defer rows.Close()
+	queryCache, err := scanQueryData(rows, p.ColumnMeta)
+	if err != nil {
+		return query, err
+	}
+	rowIdx := int(queryCache.Total)
+	query.Columns = queryCache.Columns
+	query.ColumnTypes = queryCache.ColumnTypes
+	if rowsCount < 0 {
+		rowsCount = 0
+	}
+	if rowsCount == 0 {
+		query.Rows = queryCache.Rows
+	} else {
+		if rowsCount > rowIdx {
+			rowsCount = rowIdx
+		}
+		query.Rows = queryCache.Rows[:rowsCount]
+	}
+	query.Total = queryCache.Total
+	// 开始缓存，方便导出，有数据即缓存
+	if p.EnableCache && rowsCount > 0 { // && rowsCount < rowIdx {
+		cacheTag := fmt.Sprintf("%s%d-%d", p.CacheHead, time.Now().UnixNano(), rowIdx)
+		query.CacheTag = cacheTag
+		go func(b []byte, err error) {
+			if err == nil {
+				ioutil.WriteFile(filepath.Join(p.CacheDir, cacheTag), b, 0664)
+			}
+		}(qdMarshal(queryCache))
+	}
+	return query, nil
+}
 
+// scanQueryData 读取全部结果行，值为nil的字段转为空字符串，meta为true时记录字段类型和NULL字段
+func scanQueryData(rows *sql.Rows, meta bool) (*QueryData, error) {
+	query := &QueryData{}
 	columns, err := rows.Columns()
 	if err != nil {
 		return query, err
 	}
 	query.Columns = columns
-	queryCache.Columns = columns
+	if meta {
+		query.ColumnTypes = columnTypeNames(rows)
+	}
 
 	count := len(columns)
 	values := make([]interface{}, count)
@@ -511,8 +618,6 @@ func (p *SQLPool) QueryPB2(s string, rowsCount int, params ...interface{}) (quer
 		scanArgs[i] = &values[i]
 	}
 	query.Rows = make([]*QueryDataRow, 0)
-	queryCache.Rows = make([]*QueryDataRow, 0)
-	var rowIdx = 0
 	for rows.Next() {
 		err := rows.Scan(scanArgs...)
 		if err != nil {
@@ -524,6 +629,9 @@ func (p *SQLPool) QueryPB2(s string, rowsCount int, params ...interface{}) (quer
 		for k, v := range values {
 			if v == nil {
 				row.Cells[k] = ""
+				if meta {
+					row.Nulls = append(row.Nulls, int32(k))
+				}
 				continue
 			}
 			if b, ok := v.([]byte); ok {
@@ -532,36 +640,26 @@ func (p *SQLPool) QueryPB2(s string, rowsCount int, params ...interface{}) (quer
 				row.Cells[k] = fmt.Sprintf("%v", v)
 			}
 		}
-		queryCache.Rows = append(queryCache.Rows, row)
-		rowIdx++
+		query.Rows = append(query.Rows, row)
 	}
 	if err := rows.Err(); err != nil {
 		return query, err
 	}
-	if rowsCount < 0 {
-		rowsCount = 0
+	query.Total = int32(len(query.Rows))
+	return query, nil
+}
+
+// columnTypeNames 字段的数据库类型名称，驱动不支持时返回nil
+func columnTypeNames(rows *sql.Rows) []string {
+	cts, err := rows.ColumnTypes()
+	if err != nil {
+		return nil
 	}
-	if rowsCount == 0 {
-		query.Rows = queryCache.Rows
-	} else {
-		if rowsCount > rowIdx {
-			rowsCount = rowIdx
-		}
-		query.Rows = queryCache.Rows[:rowsCount]
+	names := make([]string, len(cts))
+	for k, ct := range cts {
+		names[k] = ct.DatabaseTypeName()
 	}
-	query.Total = int32(rowIdx)
-	queryCache.Total = int32(rowIdx)
-	// 开始缓存，方便导出，有数据即缓存
-	if p.EnableCache && rowsCount > 0 { // && rowsCount < rowIdx {
-		cacheTag := fmt.Sprintf("%s%d-%d", p.CacheHead, time.Now().UnixNano(), rowIdx)
-		query.CacheTag = cacheTag
-		go func(b []byte, err error) {
-			if err == nil {
-				ioutil.WriteFile(filepath.Join(p.CacheDir, cacheTag), b, 0664)
-			}
-		}(qdMarshal(queryCache))
-	}
-	return query, nil
+	return names
 }
 
 // QueryMultirowPage 执行查询语句，返回结果集的pb2序列化字节数组，检测多个字段进行换行计数
@@ -574,25 +672,30 @@ func (p *SQLPool) QueryPB2(s string, rowsCount int, params ...interface{}) (quer
 // return:
 //  结果集的pb2序列化字节数组，error
 func (p *SQLPool) QueryMultirowPage(s string, rowsCount int, keyColumeID int, params ...interface{}) (query *QueryData, err error) {
+	return p.QueryMultirowPageContext(context.Background(), s, rowsCount, keyColumeID, params...)
+}
+
+// QueryMultirowPageContext 同QueryMultirowPage，ctx取消或超过Timeout时中止执行
+func (p *SQLPool) QueryMultirowPageContext(ctx context.Context, s string, rowsCount int, keyColumeID int, params ...interface{}) (query *QueryData, err error) {
 	if keyColumeID == -1 {
-		return p.QueryPB2(s, rowsCount, params...)
+		return p.QueryPB2Context(ctx, s, rowsCount, params...)
 	}
-	p.queryLocker.Lock()
-	defer func() (*QueryData, error) {
+	defer func() {
 		if ex := recover(); ex != nil {
-			err = ex.(error)
-			return nil, err
+			query, err = nil, fmt.Errorf("%v", ex)
 		}
-		p.queryLocker.Unlock()
-		return query, err
 	}()
 	if rowsCount < 0 {
 		rowsCount = 0
 	}
 	query = &QueryData{}
 	queryCache := &QueryData{}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(p.Timeout))
+	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(p.Timeout))
 	defer cancel()
+	if err := p.acquire(ctx); err != nil {
+		return query, err
+	}
+	defer p.release()
 	rows, err := p.connPool.QueryContext(ctx, s, params...)
 	if err != nil {
 		return query, err
@@ -605,6 +708,10 @@ func (p *SQLPool) QueryMultirowPage(s string, rowsCount int, keyColumeID int, pa
 	}
 	query.Columns = columns
 	queryCache.Columns = columns
+	if p.ColumnMeta {
+		query.ColumnTypes = columnTypeNames(rows)
+		queryCache.ColumnTypes = query.ColumnTypes
+	}
 
 	count := len(columns)
 	values := make([]interface{}, count)
@@ -628,6 +735,9 @@ func (p *SQLPool) QueryMultirowPage(s string, rowsCount int, keyColumeID int, pa
 		for k, v := range values {
 			if v == nil {
 				row.Cells[k] = ""
+				if p.ColumnMeta {
+					row.Nulls = append(row.Nulls, int32(k))
+				}
 			} else {
 				b, ok := v.([]byte)
 				if ok {
@@ -677,16 +787,19 @@ func (p *SQLPool) QueryMultirowPage(s string, rowsCount int, keyColumeID int, pa
 // return:
 //   影响行数，insert的id，error
 func (p *SQLPool) Exec(s string, params ...interface{}) (rowAffected, insertID int64, err error) {
+	return p.ExecContext(context.Background(), s, params...)
+}
+
+// ExecContext 同Exec，ctx取消或超过Timeout时中止执行
+func (p *SQLPool) ExecContext(ctx context.Context, s string, params ...interface{}) (rowAffected, insertID int64, err error) {
 	p.execLocker.Lock()
-	defer func() (int64, int64, error) {
+	defer p.execLocker.Unlock()
+	defer func() {
 		if ex := recover(); ex != nil {
-			err = ex.(error)
-			return 0, 0, err
+			rowAffected, insertID, err = 0, 0, fmt.Errorf("%v", ex)
 		}
-		p.execLocker.Unlock()
-		return rowAffected, insertID, nil
 	}()
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(p.Timeout))
+	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(p.Timeout))
 	defer cancel()
 	res, err := p.connPool.ExecContext(ctx, s, params...)
 	if err != nil {
@@ -706,14 +819,17 @@ func (p *SQLPool) Exec(s string, params ...interface{}) (rowAffected, insertID i
 // return:
 //  error
 func (p *SQLPool) ExecPrepare(s string, paramNum int, params ...interface{}) (err error) {
+	return p.ExecPrepareContext(context.Background(), s, paramNum, params...)
+}
+
+// ExecPrepareContext 同ExecPrepare，ctx取消或超过Timeout时中止执行
+func (p *SQLPool) ExecPrepareContext(ctx context.Context, s string, paramNum int, params ...interface{}) (err error) {
 	p.execLocker.Lock()
-	defer func() error {
+	defer p.execLocker.Unlock()
+	defer func() {
 		if ex := recover(); ex != nil {
-			err = ex.(error)
-			return err
+			err = fmt.Errorf("%v", ex)
 		}
-		p.execLocker.Unlock()
-		return nil
 	}()
 	if paramNum == 0 {
 		paramNum = strings.Count(s, "?")
@@ -724,7 +840,7 @@ func (p *SQLPool) ExecPrepare(s string, paramNum int, params ...interface{}) (er
 		return fmt.Errorf("not enough params")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(p.Timeout))
+	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(p.Timeout))
 	defer cancel()
 	// 开启事务
 	st, err := p.connPool.PrepareContext(ctx, s)
@@ -747,12 +863,17 @@ func (p *SQLPool) ExecPrepare(s string, paramNum int, params ...interface{}) (er
 	return nil
 }
 func (p *SQLPool) ExecPrepareV2(s string, paramNum int, params ...interface{}) (int64, []int64, error) {
+	return p.ExecPrepareV2Context(context.Background(), s, paramNum, params...)
+}
+
+// ExecPrepareV2Context 同ExecPrepareV2，ctx取消或超过Timeout时中止执行
+func (p *SQLPool) ExecPrepareV2Context(ctx context.Context, s string, paramNum int, params ...interface{}) (int64, []int64, error) {
 	p.execLocker.Lock()
+	defer p.execLocker.Unlock()
 	defer func() {
 		if err := recover(); err != nil {
-			p.Logger.Error("ExecPrepareV2 Err: " + err.(error).Error())
+			p.Logger.Error(fmt.Sprintf("ExecPrepareV2 Err: %v", err))
 		}
-		p.execLocker.Unlock()
 	}()
 	if paramNum == 0 {
 		paramNum = strings.Count(s, "?")
@@ -763,7 +884,7 @@ func (p *SQLPool) ExecPrepareV2(s string, paramNum int, params ...interface{}) (
 		return 0, nil, fmt.Errorf("not enough params")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(p.Timeout))
+	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(p.Timeout))
 	defer cancel()
 	// 开启事务
 	st, err := p.connPool.PrepareContext(ctx, s)
@@ -802,14 +923,17 @@ func (p *SQLPool) ExecPrepareV2(s string, paramNum int, params ...interface{}) (
 // return:
 //  error
 func (p *SQLPool) ExecBatch(s []string) (err error) {
+	return p.ExecBatchContext(context.Background(), s)
+}
+
+// ExecBatchContext 同ExecBatch，ctx取消或超过Timeout时中止执行
+func (p *SQLPool) ExecBatchContext(ctx context.Context, s []string) (err error) {
 	p.execLocker.Lock()
-	defer func() error {
+	defer p.execLocker.Unlock()
+	defer func() {
 		if ex := recover(); ex != nil {
-			err = ex.(error)
-			return err
+			err = fmt.Errorf("%v", ex)
 		}
-		p.execLocker.Unlock()
-		return nil
 	}()
 	// 检查语句，有任意语句存在风险，全部语句均不执行
 	for _, v := range s {
@@ -818,7 +942,7 @@ func (p *SQLPool) ExecBatch(s []string) (err error) {
 		}
 	}
 	// 开启事务
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(p.Timeout))
+	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(p.Timeout))
 	defer cancel()
 	tx, err := p.connPool.BeginTx(ctx, nil)
 	if err != nil {
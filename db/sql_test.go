@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xyzj/gopsu"
+)
+
+// stubLatency 模拟数据库单次查询耗时
+const stubLatency = time.Millisecond
+
+func init() {
+	sql.Register("gopsu-stub", stubDriver{})
+}
+
+// stubDriver 测试用驱动，每次查询等待stubLatency后返回固定的10行数据
+type stubDriver struct{}
+
+func (stubDriver) Open(string) (driver.Conn, error) { return stubConn{}, nil }
+
+type stubConn struct{}
+
+func (stubConn) Prepare(q string) (driver.Stmt, error) { return stubStmt{}, nil }
+func (stubConn) Close() error                          { return nil }
+func (stubConn) Begin() (driver.Tx, error)             { return nil, fmt.Errorf("not supported") }
+
+type stubStmt struct{}
+
+func (stubStmt) Close() error  { return nil }
+func (stubStmt) NumInput() int { return -1 }
+func (stubStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+func (stubStmt) Query(args []driver.Value) (driver.Rows, error) {
+	time.Sleep(stubLatency)
+	return &stubRows{}, nil
+}
+
+type stubRows struct{ n int }
+
+func (r *stubRows) Columns() []string { return []string{"id", "name"} }
+func (r *stubRows) Close() error      { return nil }
+func (r *stubRows) ColumnTypeDatabaseTypeName(i int) string {
+	return []string{"INT", "VARCHAR"}[i]
+}
+func (r *stubRows) Next(dest []driver.Value) error {
+	if r.n >= 10 {
+		return io.EOF
+	}
+	r.n++
+	dest[0] = int64(r.n)
+	dest[1] = []byte("name")
+	return nil
+}
+
+func newStubPool(b testing.TB, maxConcurrent int) *SQLPool {
+	db, err := sql.Open("gopsu-stub", "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	db.SetMaxOpenConns(100)
+	db.SetMaxIdleConns(100)
+	p := &SQLPool{
+		connPool:      db,
+		Timeout:       120,
+		MaxOpenConns:  100,
+		MaxConcurrent: maxConcurrent,
+		Logger:        &gopsu.NilLogger{},
+	}
+	if maxConcurrent > 0 {
+		p.limiter = make(chan struct{}, maxConcurrent)
+	}
+	return p
+}
+
+// BenchmarkQueryPB2Parallel 并发查询的吞吐量，serial模拟原先由queryLocker串行执行的情况
+func BenchmarkQueryPB2Parallel(b *testing.B) {
+	for _, n := range []int{0, 4, 16} {
+		name := "unlimited"
+		if n > 0 {
+			name = fmt.Sprintf("max-%d", n)
+		}
+		b.Run(name, func(b *testing.B) {
+			p := newStubPool(b, n)
+			defer p.connPool.Close()
+			b.SetParallelism(8)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := p.QueryPB2Context(context.Background(), "select", 0); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+	b.Run("serial", func(b *testing.B) {
+		p := newStubPool(b, 0)
+		defer p.connPool.Close()
+		var locker sync.Mutex
+		b.SetParallelism(8)
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				locker.Lock()
+				_, err := p.QueryPB2Context(context.Background(), "select", 0)
+				locker.Unlock()
+				if err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
+
+// TestColumnMeta 无论是否指定换行字段，启用ColumnMeta时都返回字段类型
+func TestColumnMeta(t *testing.T) {
+	p := newStubPool(t, 0)
+	defer p.connPool.Close()
+	for _, meta := range []bool{false, true} {
+		p.ColumnMeta = meta
+		for _, key := range []int{-1, 0} {
+			qd, err := p.QueryMultirowPageContext(context.Background(), "select", 0, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if qd.Total != 10 {
+				t.Errorf("meta=%v key=%d: total = %d", meta, key, qd.Total)
+			}
+			got := strings.Join(qd.ColumnTypes, ",")
+			if want := map[bool]string{false: "", true: "INT,VARCHAR"}[meta]; got != want {
+				t.Errorf("meta=%v key=%d: column types = %q, want %q", meta, key, got, want)
+			}
+		}
+	}
+}
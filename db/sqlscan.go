@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// QueryStructs 执行查询语句，将结果按字段映射写入结构体切片
+//
+// args:
+//  dest: 结构体切片指针，如*[]T或*[]*T
+//  s: sql占位符语句
+//  params: 查询参数,语句中的参数用`?`占位
+// 字段映射规则：
+//  优先使用`db:"name"`tag，为"-"时忽略该字段，未设置时按字段名称（忽略大小写）匹配
+//  匿名嵌入的结构体会展开，没有对应字段的列会被忽略
+//  可为NULL的列应使用指针或sql.NullString等类型，否则扫描时返回错误
+func (p *SQLPool) QueryStructs(ctx context.Context, dest interface{}, s string, params ...interface{}) (err error) {
+	defer func() {
+		if ex := recover(); ex != nil {
+			err = fmt.Errorf("%v", ex)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(p.Timeout))
+	defer cancel()
+	if err := p.acquire(ctx); err != nil {
+		return err
+	}
+	defer p.release()
+	rows, err := p.connPool.QueryContext(ctx, s, params...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return scanStructs(rows, dest)
+}
+
+// QueryStructs 在事务中执行查询语句，将结果写入结构体切片，参数同SQLPool.QueryStructs
+func (t *SQLTx) QueryStructs(dest interface{}, s string, params ...interface{}) error {
+	rows, err := t.tx.QueryContext(t.ctx, s, params...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return scanStructs(rows, dest)
+}
+
+// scanStructs 读取全部结果行并追加到dest指向的切片
+func scanStructs(rows *sql.Rows, dest interface{}) error {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() || dv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("dest must be a pointer to slice")
+	}
+	sv := dv.Elem()
+	et := sv.Type().Elem()
+	isPtr := et.Kind() == reflect.Ptr
+	if isPtr {
+		et = et.Elem()
+	}
+	if et.Kind() != reflect.Struct {
+		return fmt.Errorf("dest element must be struct or struct pointer")
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	fields := structFields(et)
+	idx := make([][]int, len(columns))
+	for k, col := range columns {
+		idx[k] = fields[strings.ToLower(col)]
+	}
+	scanArgs := make([]interface{}, len(columns))
+	for rows.Next() {
+		ev := reflect.New(et)
+		for k := range columns {
+			if idx[k] == nil {
+				scanArgs[k] = new(interface{})
+				continue
+			}
+			scanArgs[k] = ev.Elem().FieldByIndex(idx[k]).Addr().Interface()
+		}
+		if err := rows.Scan(scanArgs...); err != nil {
+			return err
+		}
+		if isPtr {
+			sv = reflect.Append(sv, ev)
+		} else {
+			sv = reflect.Append(sv, ev.Elem())
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	dv.Elem().Set(sv)
+	return nil
+}
+
+// structFields 返回小写列名到字段索引的映射，匿名嵌入的结构体会展开，外层字段优先
+func structFields(t reflect.Type) map[string][]int {
+	m := make(map[string][]int)
+	var embedded [][]int
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("db")
+		if tag == "-" {
+			continue
+		}
+		if sf.Anonymous && tag == "" && sf.Type.Kind() == reflect.Struct {
+			embedded = append(embedded, sf.Index)
+			continue
+		}
+		if sf.PkgPath != "" { // 未导出字段
+			continue
+		}
+		name := tag
+		if name == "" {
+			name = sf.Name
+		}
+		m[strings.ToLower(name)] = sf.Index
+	}
+	for _, index := range embedded {
+		for name, sub := range structFields(t.FieldByIndex(index).Type) {
+			if _, ok := m[name]; !ok {
+				m[name] = append(append([]int{}, index...), sub...)
+			}
+		}
+	}
+	return m
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RowIter 逐行读取查询结果，不缓存结果集，适用于导出大量数据
+//	用法: for it.Next() { row := it.Row() }，结束后检查it.Err()，并调用Close
+type RowIter struct {
+	rows     *sql.Rows
+	cancel   context.CancelFunc
+	release  func()
+	columns  []string
+	values   []interface{}
+	scanArgs []interface{}
+	row      []string
+	err      error
+	closed   bool
+}
+
+// QueryIter 执行查询语句，返回逐行读取的迭代器，使用完毕必须调用Close释放连接
+//
+// args:
+//  ctx: 整个读取过程的上下文，设置了StreamTimeout时同时受其限制，不受Timeout限制
+//  s: sql占位符语句
+//  params: 查询参数,语句中的参数用`?`占位
+// return:
+//  迭代器，error
+func (p *SQLPool) QueryIter(ctx context.Context, s string, params ...interface{}) (*RowIter, error) {
+	var cancel context.CancelFunc
+	if p.StreamTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Second*time.Duration(p.StreamTimeout))
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	if err := p.acquire(ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+	rows, err := p.connPool.QueryContext(ctx, s, params...)
+	if err != nil {
+		p.release()
+		cancel()
+		return nil, err
+	}
+	it := &RowIter{
+		rows:    rows,
+		cancel:  cancel,
+		release: p.release,
+	}
+	if it.columns, err = rows.Columns(); err != nil {
+		it.Close()
+		return nil, err
+	}
+	count := len(it.columns)
+	it.values = make([]interface{}, count)
+	it.scanArgs = make([]interface{}, count)
+	for i := range it.values {
+		it.scanArgs[i] = &it.values[i]
+	}
+	it.row = make([]string, count)
+	return it, nil
+}
+
+// Columns 返回列名
+func (it *RowIter) Columns() []string {
+	return it.columns
+}
+
+// Next 读取下一行，没有更多数据或出错时返回false并自动关闭
+func (it *RowIter) Next() bool {
+	if it.closed {
+		return false
+	}
+	if !it.rows.Next() {
+		it.err = it.rows.Err()
+		it.Close()
+		return false
+	}
+	if err := it.rows.Scan(it.scanArgs...); err != nil {
+		it.err = err
+		it.Close()
+		return false
+	}
+	for k, v := range it.values {
+		switch vv := v.(type) {
+		case nil:
+			it.row[k] = ""
+		case []byte:
+			it.row[k] = string(vv)
+		default:
+			it.row[k] = fmt.Sprintf("%v", vv)
+		}
+	}
+	return true
+}
+
+// Row 返回当前行，值为NULL的字段为空字符串，返回的切片在下次调用Next时会被覆盖
+func (it *RowIter) Row() []string {
+	return it.row
+}
+
+// Err 返回读取过程中的错误
+func (it *RowIter) Err() error {
+	return it.err
+}
+
+// Close 关闭迭代器并释放连接，可重复调用
+func (it *RowIter) Close() error {
+	if it.closed {
+		return nil
+	}
+	it.closed = true
+	err := it.rows.Close()
+	it.cancel()
+	it.release()
+	return err
+}
+
+// QueryStream 执行查询语句，逐行调用fn，fn返回error时中止读取并返回该error
+//	row在fn返回后会被覆盖，需要保留时请复制
+func (p *SQLPool) QueryStream(ctx context.Context, s string, fn func(row []string) error, params ...interface{}) error {
+	it, err := p.QueryIter(ctx, s, params...)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.Next() {
+		if err := fn(it.Row()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/xyzj/gopsu"
+)
+
+var savepointName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SQLTx 事务，仅在SQLPool.Tx的回调函数内有效
+type SQLTx struct {
+	tx     *sql.Tx
+	ctx    context.Context
+	driver driveType
+	meta   bool
+}
+
+// Tx 开启事务并执行fn，fn返回error或发生panic时回滚，否则提交
+//
+// args:
+//  ctx: 整个事务的上下文，同时受Timeout限制
+//  fn: 事务内的操作，使用tx执行语句
+//  opts: 事务选项，可设置隔离级别和只读，如&sql.TxOptions{Isolation: sql.LevelSerializable}
+// return:
+//  fn或提交事务的error
+// 事务不占用MaxConcurrent的名额，fn中调用SQLPool的查询方法不会等待事务自身，但这些查询不在事务中执行
+func (p *SQLPool) Tx(ctx context.Context, fn func(tx *SQLTx) error, opts ...*sql.TxOptions) (err error) {
+	if p.connPool == nil {
+		return fmt.Errorf("sql connection is not ready")
+	}
+	var opt *sql.TxOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(p.Timeout))
+	defer cancel()
+	tx, err := p.connPool.BeginTx(ctx, opt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if ex := recover(); ex != nil {
+			err = fmt.Errorf("%v", ex)
+		}
+		if err != nil {
+			if ex := tx.Rollback(); ex != nil && ex != sql.ErrTxDone && p.Logger != nil {
+				p.Logger.Error("Tx Rollback Err: " + ex.Error())
+			}
+		}
+	}()
+	if err = fn(&SQLTx{tx: tx, ctx: ctx, driver: p.DriverType, meta: p.ColumnMeta}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// QueryPB2 在事务中执行查询语句，参数同SQLPool.QueryPB2，结果不缓存
+func (t *SQLTx) QueryPB2(s string, rowsCount int, params ...interface{}) (*QueryData, error) {
+	rows, err := t.tx.QueryContext(t.ctx, s, params...)
+	if err != nil {
+		return &QueryData{}, err
+	}
+	defer rows.Close()
+	query, err := scanQueryData(rows, t.meta)
+	if err != nil {
+		return query, err
+	}
+	if rowsCount > 0 && rowsCount < len(query.Rows) {
+		query.Rows = query.Rows[:rowsCount]
+	}
+	return query, nil
+}
+
+// QueryJSON 在事务中执行查询语句，返回json字符串，参数同SQLPool.QueryJSON
+func (t *SQLTx) QueryJSON(s string, rowsCount int, params ...interface{}) (string, error) {
+	x, err := t.QueryPB2(s, rowsCount, params...)
+	if err != nil {
+		return "", err
+	}
+	return string(gopsu.PB2Json(x)), nil
+}
+
+// Exec 在事务中执行语句，返回（影响行数,insertId,error），参数同SQLPool.Exec
+func (t *SQLTx) Exec(s string, params ...interface{}) (rowAffected, insertID int64, err error) {
+	res, err := t.tx.ExecContext(t.ctx, s, params...)
+	if err != nil {
+		return 0, 0, err
+	}
+	insertID, _ = res.LastInsertId()
+	rowAffected, _ = res.RowsAffected()
+	return rowAffected, insertID, nil
+}
+
+// ExecPrepare 在事务中批量执行相同的占位符语句，参数同SQLPool.ExecPrepare
+func (t *SQLTx) ExecPrepare(s string, paramNum int, params ...interface{}) error {
+	if paramNum == 0 {
+		paramNum = strings.Count(s, "?")
+	}
+	l := len(params)
+	if paramNum == 0 || l%paramNum != 0 {
+		return fmt.Errorf("not enough params")
+	}
+	st, err := t.tx.PrepareContext(t.ctx, s)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	for i := 0; i < l; i += paramNum {
+		if _, err := st.ExecContext(t.ctx, params[i:i+paramNum]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Savepoint 创建保存点，仅支持mysql
+func (t *SQLTx) Savepoint(name string) error {
+	return t.savepoint("SAVEPOINT ", name)
+}
+
+// RollbackTo 回滚到保存点，保存点之前的操作仍在事务中，仅支持mysql
+func (t *SQLTx) RollbackTo(name string) error {
+	return t.savepoint("ROLLBACK TO SAVEPOINT ", name)
+}
+
+// ReleaseSavepoint 释放保存点，仅支持mysql
+func (t *SQLTx) ReleaseSavepoint(name string) error {
+	return t.savepoint("RELEASE SAVEPOINT ", name)
+}
+
+func (t *SQLTx) savepoint(stmt, name string) error {
+	if t.driver != DriverMYSQL {
+		return fmt.Errorf("savepoint only support mysql driver")
+	}
+	if !savepointName.MatchString(name) {
+		return fmt.Errorf("invalid savepoint name %q", name)
+	}
+	_, err := t.tx.ExecContext(t.ctx, stmt+name)
+	return err
+}
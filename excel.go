@@ -2,6 +2,8 @@ package gopsu
 
 import (
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/tealeg/xlsx"
 )
@@ -50,6 +52,80 @@ func (e *excelData) AddRow(cells ...interface{}) {
 	}
 }
 
+// RowReader 逐行读取的数据源，如db.RowIter
+type RowReader interface {
+	Columns() []string
+	Next() bool
+	Row() []string
+	Err() error
+}
+
+// excelMaxRows 单个sheet的最大行数
+const excelMaxRows = 1048576
+
+// excelStreamBatch 流式写入时每次提交的行数
+const excelStreamBatch = 1000
+
+// WriteExcel 从r逐行读取数据，以xlsx格式直接写入w，不在内存中保存整个文件，适用于导出大量数据
+// sheetname: sheet名称，首行为r.Columns()
+// 返回写入的数据行数，错误，超过单个sheet行数上限时写入已读取的部分并返回错误
+func WriteExcel(w io.Writer, sheetname string, r RowReader) (int, error) {
+	columns := r.Columns()
+	sb := xlsx.NewStreamFileBuilder(w)
+	if err := sb.AddSheet(sheetname, columns, nil); err != nil {
+		return 0, fmt.Errorf("excel-sheet创建失败:" + err.Error())
+	}
+	sf, err := sb.Build()
+	if err != nil {
+		return 0, fmt.Errorf("excel-文件创建失败:" + err.Error())
+	}
+	var count int
+	var ex error
+	batch := make([][]string, 0, excelStreamBatch)
+	for r.Next() {
+		if count >= excelMaxRows-1 {
+			ex = fmt.Errorf("excel-超过单个sheet的最大行数%d", excelMaxRows)
+			break
+		}
+		// Row返回的切片会被覆盖，需要复制
+		batch = append(batch, append([]string{}, r.Row()...))
+		count++
+		if len(batch) == excelStreamBatch {
+			if err := sf.WriteAll(batch); err != nil {
+				return count, fmt.Errorf("excel-写入失败:" + err.Error())
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err := sf.WriteAll(batch); err != nil {
+			return count, fmt.Errorf("excel-写入失败:" + err.Error())
+		}
+	}
+	if err := sf.Close(); err != nil {
+		return count, fmt.Errorf("excel-文件保存失败:" + err.Error())
+	}
+	if ex != nil {
+		return count, ex
+	}
+	return count, r.Err()
+}
+
+// ExportExcel 从r逐行读取数据写入xlsx文件，参见WriteExcel
+// filename: 完整文件名，需包含扩展名
+// 返回写入的数据行数，错误
+func ExportExcel(filename, sheetname string, r RowReader) (int, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return 0, fmt.Errorf("excel-文件创建失败:" + err.Error())
+	}
+	count, err := WriteExcel(f, sheetname, r)
+	if ex := f.Close(); err == nil && ex != nil {
+		err = fmt.Errorf("excel-文件保存失败:" + ex.Error())
+	}
+	return count, err
+}
+
 // SetColume 设置列头
 // columeName: 列头名，有多少写多少个
 func (e *excelData) SetColume(columeName ...string) {
@@ -5,9 +5,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -19,23 +17,10 @@ var json = jsoniter.Config{}.Froze()
 var md5worker = gopsu.GetNewCryptoWorker(gopsu.CryptoMD5)
 
 type ginLogger struct {
-	fno       *os.File     // 文件日志
-	fname     string       // 日志文件名
-	fileIndex byte         // 文件索引号
-	expired   int64        // 日志文件过期时长
-	flock     sync.RWMutex // 同步锁
-	nameOld   string       // 旧日志文件名
-	nameNow   string       // 当前日志文件名
-	fileHour  int          // 旧时间戳
-	fileDay   int          // 日期戳
-	pathOld   string       // 写入用日志路径
-	pathNow   string       // 当前日志路径
-	logDir    string       // 日志文件夹
-	maxDays   int          // 文件有效时间
-	out       io.Writer    // io写入
-	err       error        // 错误信息
-	enablegz  bool         // 是否允许gzip压缩旧日志文件
-	skipPath  []string     // 不记录日志的路由
+	rf       *gopsu.RollingFile // 滚动日志文件
+	maxDays  int                // 文件有效时间
+	out      io.Writer          // io写入
+	skipPath []string           // 不记录日志的路由
 }
 
 // LoggerWithRolling 滚动日志
@@ -45,55 +30,41 @@ type ginLogger struct {
 func LoggerWithRolling(logdir, filename string, maxdays int) gin.HandlerFunc {
 	return LoggerWithRollingSkip(logdir, filename, maxdays, []string{"/static"})
 }
+
+// LoggerWithRollingSkip 滚动日志，skippath中的路由不记录日志
 func LoggerWithRollingSkip(logdir, filename string, maxdays int, skippath []string) gin.HandlerFunc {
-	t := time.Now()
+	return LoggerWithRollingOpt(gopsu.RollingOpt{
+		Dir:      logdir,
+		Name:     filename,
+		MaxDays:  maxdays,
+		Compress: true,
+	}, skippath)
+}
+
+// LoggerWithRollingOpt 滚动日志，可设置文件大小，切分周期，保留数量等，参见gopsu.RollingOpt
+// opt.MaxDays<=1时不写文件，只输出到控制台，<=0时不记录日志
+func LoggerWithRollingOpt(opt gopsu.RollingOpt, skippath []string) gin.HandlerFunc {
 	// 初始化
 	f := &ginLogger{
-		logDir:   logdir,
-		fname:    filename,
-		expired:  int64(maxdays)*24*60*60 - 10,
-		maxDays:  maxdays,
-		fileHour: t.Hour(),
-		fileDay:  t.Day(),
-		pathOld:  filepath.Join(logdir, fmt.Sprintf("%s.current.log", filename)),
-		enablegz: true,
+		maxDays:  opt.MaxDays,
 		skipPath: skippath,
 	}
-	if f.maxDays <= 1 {
-		f.fname = ""
-	}
-	// 搜索最后一个文件名
-	for i := byte(255); i > 0; i-- {
-		if gopsu.IsExist(filepath.Join(f.logDir, fmt.Sprintf("%s.%v.%d.log", filename, t.Format(gopsu.FileTimeFormat), i))) {
-			f.fileIndex = i
-		}
-	}
-	// 创建新日志
-	f.newFile()
+	// 创建日志
+	f.newFile(opt)
 	// 设置io
 	gin.DefaultWriter = f.out
 	gin.DefaultErrorWriter = f.out
 	// 创建写入线程
 	var chanWriteLog = make(chan string, 100)
 	go func() {
-		tc := time.NewTicker(time.Minute * 10)
 	RUN:
 		func() {
 			defer func() {
 				recover()
 			}()
 			time.Sleep(time.Second * 3)
-			for {
-				select {
-				case s := <-chanWriteLog:
-					fmt.Fprintln(f.out, s)
-				case <-tc.C:
-					// 检查是否需要切分文件
-					if f.rollingFile() {
-						gin.DefaultWriter = f.out
-						gin.DefaultErrorWriter = f.out
-					}
-				}
+			for s := range chanWriteLog {
+				fmt.Fprintln(f.out, s)
 			}
 		}()
 		goto RUN
@@ -164,125 +135,22 @@ func LoggerWithRollingSkip(logdir, filename string, maxdays int, skippath []stri
 	}
 }
 
-// 检查文件大小,返回是否需要切分文件
-func (f *ginLogger) rolledWithFileSize() bool {
-	if f.fileHour == time.Now().Hour() {
-		return false
-	}
-	f.fileHour = time.Now().Hour()
-	fs, ex := os.Stat(f.pathNow)
-	if ex == nil {
-		if fs.Size() > 1048576000 {
-			if f.fileIndex >= 255 {
-				f.fileIndex = 0
-			} else {
-				f.fileIndex++
-			}
-			return true
-		}
-	}
-	return false
-}
-
-// 按日期切分文件
-func (f *ginLogger) rollingFile() bool {
-	if f.fname == "" {
-		return false
-	}
-	f.flock.Lock()
-	defer f.flock.Unlock()
-
-	t := time.Now()
-	f.rolledWithFileSize()
-	f.nameNow = fmt.Sprintf("%s.%v.%d.log", f.fname, t.Format(gopsu.FileTimeFormat), f.fileIndex)
-	// 比对文件名，若不同则重新设置io
-	if f.nameNow == f.nameOld {
-		return false
-	}
-	// 创建新日志
-	f.newFile()
-	// 清理旧日志
-	f.cleanFile()
-
-	return true
-}
-
-// 压缩旧日志
-func (f *ginLogger) zipFile(s string) {
-	if f.fname == "" || !f.enablegz || len(s) == 0 || !gopsu.IsExist(filepath.Join(f.logDir, s)) {
-		return
-	}
-	go func(s string) {
-		err := gopsu.ZIPFile(f.logDir, s, true)
-		if err != nil {
-			fmt.Fprintln(f.out, "zip log file error: "+s+" "+err.Error())
-			return
-		}
-	}(s)
-}
-
-// 清理旧日志
-func (f *ginLogger) cleanFile() {
-	// 若未设置超时，则不清理
-	if f.fname == "" || f.expired == 0 {
+// 创建日志文件
+func (f *ginLogger) newFile(opt gopsu.RollingOpt) {
+	if f.maxDays <= 1 {
+		f.out = io.MultiWriter(os.Stdout)
 		return
 	}
-	go func() {
-		defer func() { recover() }()
-
-		// 遍历文件夹
-		lstfno, ex := ioutil.ReadDir(f.logDir)
-		if ex != nil {
-			ioutil.WriteFile("ginlogerr.log", []byte(fmt.Sprintf("clear log files error: %s", ex.Error())), 0664)
-			return
-		}
-		t := time.Now()
-		for _, fno := range lstfno {
-			if fno.IsDir() || !strings.Contains(fno.Name(), f.fname) { // 忽略目录，不含日志名的文件，以及当前文件
-				continue
-			}
-			// 比对文件生存期
-			if t.Unix()-fno.ModTime().Unix() >= f.expired {
-				os.Remove(filepath.Join(f.logDir, fno.Name()))
-			}
-		}
-	}()
-}
-
-// 创建新日志文件
-func (f *ginLogger) newFile() {
-	if f.fname == "" {
+	var err error
+	f.rf, err = gopsu.NewRollingFile(opt)
+	if err != nil {
+		ioutil.WriteFile("ginlogerr.log", []byte("Log file open error: "+err.Error()), 0664)
 		f.out = io.MultiWriter(os.Stdout)
 		return
 	}
-	t := time.Now()
-	if f.fileDay != t.Day() {
-		f.fileDay = t.Day()
-		f.fileIndex = 0
-	}
-	if f.fno != nil {
-		f.fno.Close()
-	}
-	// 直接写入当日日志
-	f.nameNow = fmt.Sprintf("%s.%v.%d.log", f.fname, t.Format(gopsu.FileTimeFormat), f.fileIndex)
-	f.pathNow = filepath.Join(f.logDir, f.nameNow)
-	f.pathOld = f.pathNow
-
-	// 打开文件
-	f.fno, f.err = os.OpenFile(f.pathOld, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0664)
-	if f.err != nil {
-		ioutil.WriteFile("ginlogerr.log", []byte("Log file open error: "+f.err.Error()), 0664)
-		f.out = io.MultiWriter(os.Stdout)
+	if gin.Mode() == "debug" {
+		f.out = io.MultiWriter(f.rf, os.Stdout)
 	} else {
-		if gin.Mode() == "debug" {
-			f.out = io.MultiWriter(f.fno, os.Stdout)
-		} else {
-			f.out = io.MultiWriter(f.fno)
-		}
-	}
-	// 判断是否压缩旧日志
-	if f.enablegz {
-		f.zipFile(f.nameOld)
+		f.out = io.MultiWriter(f.rf)
 	}
-	f.nameOld = f.nameNow
 }
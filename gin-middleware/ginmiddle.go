@@ -1,8 +1,10 @@
 package ginmiddleware
 
 import (
+	"bytes"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/csv"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -354,6 +356,88 @@ func ReadCachePB2(mydb db.SQLInterface) gin.HandlerFunc {
 	}
 }
 
+// StreamQuery 逐行输出查询结果，不缓存结果集，适用于导出大量数据
+//	build: 根据请求生成sql语句和参数，返回error时响应400
+//	参数format: 为csv时输出csv（首行为列头），否则输出ndjson（每行一个以列名为键的json对象）
+//	读取中途出错时响应已发出，错误会记录到gin.DefaultErrorWriter并写入X-Stream-Error trailer，
+//	ndjson格式还会在末尾追加一行{"error":"..."}
+func StreamQuery(mydb db.SQLInterface, build func(c *gin.Context) (string, []interface{}, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s, params, err := build(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		it, err := mydb.QueryIter(c.Request.Context(), s, params...)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		defer it.Close()
+		c.Header("Trailer", "X-Stream-Error")
+		var count int
+		ndjson := c.Param("format") != "csv"
+		if !ndjson {
+			c.Header("Content-Type", "text/csv; charset=utf-8")
+			c.Status(http.StatusOK)
+			w := csv.NewWriter(c.Writer)
+			w.Write(it.Columns())
+			for it.Next() {
+				if w.Write(it.Row()) != nil {
+					return
+				}
+				if count++; count%1000 == 0 {
+					// 客户端断开等写入错误在Flush后才能得知，出错时停止读取
+					if w.Flush(); w.Error() != nil {
+						return
+					}
+					c.Writer.Flush()
+				}
+			}
+			if w.Flush(); w.Error() != nil {
+				return
+			}
+		} else {
+			keys := make([][]byte, len(it.Columns()))
+			for k, v := range it.Columns() {
+				keys[k], _ = json.Marshal(v)
+			}
+			c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+			c.Status(http.StatusOK)
+			var buf bytes.Buffer
+			for it.Next() {
+				buf.Reset()
+				buf.WriteByte('{')
+				for k, v := range it.Row() {
+					if k > 0 {
+						buf.WriteByte(',')
+					}
+					b, _ := json.Marshal(v)
+					buf.Write(keys[k])
+					buf.WriteByte(':')
+					buf.Write(b)
+				}
+				buf.WriteString("}\n")
+				if _, err := c.Writer.Write(buf.Bytes()); err != nil {
+					return
+				}
+				if count++; count%1000 == 0 {
+					c.Writer.Flush()
+				}
+			}
+		}
+		if err := it.Err(); err != nil {
+			fmt.Fprintf(gin.DefaultErrorWriter, "[GIN] %s | stream query %s aborted after %d rows: %v\n", time.Now().Format(gopsu.LongTimeFormat), c.Request.URL.Path, count, err)
+			c.Writer.Header().Set("X-Stream-Error", err.Error())
+			if ndjson {
+				b, _ := json.Marshal(gin.H{"error": err.Error()})
+				c.Writer.Write(append(b, '\n'))
+			}
+			c.Error(err)
+		}
+	}
+}
+
 // CheckSecurityCode 校验安全码
 // codeType: 安全码更新周期，h: 每小时更新，m: 每分钟更新
 // codeRange: 安全码容错范围（分钟）
@@ -95,3 +95,107 @@ func Clearlog(c *gin.Context) {
 	}
 	c.PureJSON(200, c.Keys)
 }
+
+// LogLevel 查看或修改日志级别，需配合ReadParams使用
+//	参数level: 新的日志级别，数字或名称（debug,info,warning,error,system），为空时仅查看
+//	参数module: 子日志名称，为空时修改主日志级别，module不为空且level=0时恢复使用主日志级别
+func LogLevel(l gopsu.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mylog, ok := l.(*gopsu.MxLog)
+		if !ok {
+			c.String(http.StatusBadRequest, "logger does not support level change")
+			return
+		}
+		if s := c.Param("level"); s != "" {
+			module := c.Param("module")
+			level, ok := gopsu.ParseLogLevel(s)
+			switch {
+			case module != "" && gopsu.TrimString(s) == "0":
+				mylog.SetModuleLevel(module, 0)
+			case !ok:
+				c.String(http.StatusBadRequest, "unknown log level: "+s)
+				return
+			case module != "":
+				mylog.SetModuleLevel(module, level)
+			default:
+				mylog.SetLevel(level)
+			}
+			mylog.SystemKV("log level changed", "level", s, "module", module, "by", c.ClientIP())
+		}
+		c.PureJSON(http.StatusOK, gin.H{
+			"level":   mylog.Level(),
+			"modules": mylog.ModuleLevels(),
+		})
+	}
+}
+
+// logTailMaxLines LogTail单次返回的最大条数
+const logTailMaxLines = 10000
+
+// LogTail 查看日志，需配合ReadParams使用
+//	参数lines: 返回最后多少条，默认100，最多logTailMaxLines
+//	参数level: 最低日志级别，数字或名称
+//	参数grep: 正则表达式过滤
+//	参数start，end: 时间范围，格式 2006-01-02 15:04:05
+//	参数follow: 为1时持续输出新写入的日志，直到连接断开
+func LogTail(dir, name string, key []byte) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := gopsu.LogQuery{
+			Dir:  dir,
+			Name: name,
+			Grep: c.Param("grep"),
+			Key:  key,
+		}
+		if s := c.Param("level"); s != "" {
+			level, ok := gopsu.ParseLogLevel(s)
+			if !ok {
+				c.String(http.StatusBadRequest, "unknown log level: "+s)
+				return
+			}
+			q.Level = level
+		}
+		for k, t := range map[string]*time.Time{"start": &q.Start, "end": &q.End} {
+			if s := c.Param(k); s != "" {
+				v, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local)
+				if err != nil {
+					c.String(http.StatusBadRequest, "wrong "+k+" time: "+s)
+					return
+				}
+				*t = v
+			}
+		}
+		lines := gopsu.String2Int64(c.Param("lines"), 10)
+		switch {
+		case lines <= 0:
+			lines = 100
+		case lines > logTailMaxLines:
+			lines = logTailMaxLines
+		}
+		r, err := gopsu.NewLogReader(q)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		recs, err := r.Tail(int(lines))
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		c.Status(http.StatusOK)
+		for _, rec := range recs {
+			c.Writer.WriteString(rec.Text + "\n")
+		}
+		if c.Param("follow") != "1" {
+			return
+		}
+		c.Writer.Flush()
+		r.Follow(c.Request.Context(), time.Second, func(rec *gopsu.LogRecord) bool {
+			if _, err := c.Writer.WriteString(rec.Text + "\n"); err != nil {
+				return false
+			}
+			c.Writer.Flush()
+			return true
+		})
+	}
+}
@@ -8,6 +8,7 @@ replace (
 )
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/coreos/bbolt v0.0.0-00010101000000-000000000000 // indirect
 	github.com/coreos/etcd v3.3.25+incompatible // indirect
 	github.com/coreos/pkg v0.0.0-20180928190104-399ea9e2e55f // indirect
@@ -23,6 +24,7 @@ require (
 	github.com/pkg/errors v0.9.1
 	github.com/prometheus/client_golang v1.10.0 // indirect
 	github.com/streadway/amqp v1.0.0
+	github.com/tealeg/xlsx v1.0.5
 	github.com/tidwall/gjson v1.7.5
 	github.com/tidwall/sjson v1.1.6
 	github.com/unrolled/secure v1.0.9
@@ -30,4 +32,5 @@ require (
 	go.uber.org/zap v1.16.0 // indirect
 	golang.org/x/text v0.3.6
 	google.golang.org/grpc v1.26.0
+	gopkg.in/yaml.v2 v2.3.0
 )
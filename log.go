@@ -1,13 +1,16 @@
 package gopsu
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,9 +20,9 @@ const (
 	logWarning  = 30
 	logError    = 40
 	logSystem   = 90
-	maxFileLife = 15*24*60*60 - 10
-	maxFileSize = 1048576000 // 1G
 	logformater = "%s [%02d] %s"
+	// logJSONTimeFormat json格式日志的时间戳格式
+	logJSONTimeFormat = "2006-01-02T15:04:05.000Z07:00"
 )
 
 // Logger 日志接口
@@ -34,9 +37,61 @@ type Logger interface {
 	WarningFormat(f string, msgs ...interface{})
 	ErrorFormat(f string, msgs ...interface{})
 	SystemFormat(f string, msgs ...interface{})
+	DebugKV(msg string, kv ...interface{})
+	InfoKV(msg string, kv ...interface{})
+	WarningKV(msg string, kv ...interface{})
+	ErrorKV(msg string, kv ...interface{})
+	SystemKV(msg string, kv ...interface{})
 	DefaultWriter() io.Writer
 }
 
+// LogBackpressure 日志队列已满时的处理方式
+type LogBackpressure byte
+
+const (
+	// LogBlock 等待队列空闲，写日志的调用方会被阻塞
+	LogBlock LogBackpressure = iota
+	// LogDropOldest 丢弃队列中最早的日志，写入新日志
+	LogDropOldest
+	// LogDropNewest 丢弃新日志
+	LogDropNewest
+)
+
+// LogOpt 日志扩展配置
+type LogOpt struct {
+	// JSONFormat 按json行格式写日志，每行包含time，level，msg以及KV方法传入的字段
+	JSONFormat bool
+	// QueueSize 待写入日志队列长度，默认100
+	QueueSize int
+	// Backpressure 队列已满时的处理方式，默认LogBlock
+	Backpressure LogBackpressure
+	// MaxSizeMB 单个日志文件最大大小（MB），默认1000
+	MaxSizeMB int64
+	// RotateInterval 日志文件切分周期，默认RotateDaily
+	RotateInterval RotateInterval
+	// MaxFiles 最多保留的日志文件数量，0-不限制
+	MaxFiles int
+	// NameFormat 日志文件命名方法，默认DefaultRollingName
+	NameFormat func(name, period string, idx int) string
+	// KeyFile 加密密钥文件，设置后每行日志使用aes-gcm加密，密钥格式参见LoadCryptoKey，密钥无效时不写日志文件
+	//	未设置KeyFile和KeyEnv时，若程序目录存在.safemode文件，则以该文件作为密钥文件，
+	//	旧版作为标记使用的空.safemode文件不是有效密钥，同样不写日志文件，需在其中写入密钥后才能恢复
+	KeyFile string
+	// KeyEnv 加密密钥环境变量名，有值时优先于KeyFile
+	KeyEnv string
+	// Sinks 远程日志输出，如NewSyslogSink，NewJSONSink，与文件输出同时生效
+	Sinks []LogSink
+}
+
+// LogStats 日志写入统计
+type LogStats struct {
+	Written uint64 // 已写入行数
+	Dropped uint64 // 因队列已满或日志已关闭而丢弃的行数
+	Queued  int    // 队列中待写入的行数
+	// SinkDropped 各远程输出丢弃的行数，顺序同LogOpt.Sinks
+	SinkDropped []uint64
+}
+
 // NilLogger 空日志
 type NilLogger struct{}
 
@@ -70,6 +125,21 @@ func (l *NilLogger) ErrorFormat(f string, msg ...interface{}) {}
 // SystemFormat System
 func (l *NilLogger) SystemFormat(f string, msg ...interface{}) {}
 
+// DebugKV Debug
+func (l *NilLogger) DebugKV(msg string, kv ...interface{}) {}
+
+// InfoKV Info
+func (l *NilLogger) InfoKV(msg string, kv ...interface{}) {}
+
+// WarningKV Warning
+func (l *NilLogger) WarningKV(msg string, kv ...interface{}) {}
+
+// ErrorKV Error
+func (l *NilLogger) ErrorKV(msg string, kv ...interface{}) {}
+
+// SystemKV System
+func (l *NilLogger) SystemKV(msg string, kv ...interface{}) {}
+
 // DefaultWriter 返回日志Writer
 func (l *NilLogger) DefaultWriter() io.Writer { return nil }
 
@@ -126,6 +196,31 @@ func (l *StdLogger) SystemFormat(f string, msg ...interface{}) {
 	l.writeLog(fmt.Sprintf(f, msg...), 90)
 }
 
+// DebugKV Debug
+func (l *StdLogger) DebugKV(msg string, kv ...interface{}) {
+	l.writeLog(msg+formatLogKV(kv), 10)
+}
+
+// InfoKV Info
+func (l *StdLogger) InfoKV(msg string, kv ...interface{}) {
+	l.writeLog(msg+formatLogKV(kv), 20)
+}
+
+// WarningKV Warning
+func (l *StdLogger) WarningKV(msg string, kv ...interface{}) {
+	l.writeLog(msg+formatLogKV(kv), 30)
+}
+
+// ErrorKV Error
+func (l *StdLogger) ErrorKV(msg string, kv ...interface{}) {
+	l.writeLog(msg+formatLogKV(kv), 40)
+}
+
+// SystemKV System
+func (l *StdLogger) SystemKV(msg string, kv ...interface{}) {
+	l.writeLog(msg+formatLogKV(kv), 90)
+}
+
 // DefaultWriter 返回日志Writer
 func (l *StdLogger) DefaultWriter() io.Writer { return os.Stdout }
 
@@ -135,26 +230,24 @@ func (l *StdLogger) writeLog(msg string, level int) {
 
 // MxLog mx log
 type MxLog struct {
-	pathNow string
-	// fileSize      int64
-	expired       int64
-	fileMaxSize   int64
 	fname         string
-	nameNow       string
-	nameOld       string
-	fileIndex     byte
 	logDir        string
-	fileDay       int
-	fileHour      int
-	fno           *os.File
-	logLevel      int
-	enablegz      bool
-	err           error
-	fileLock      sync.RWMutex
+	rf            *RollingFile
+	logLevel      int32
 	chanWriteLog  chan string
 	out           io.Writer
 	logClassified bool
 	cWorker       *CryptoWorker
+	jsonFormat    bool
+	moduleLevels  sync.Map
+	backpressure  LogBackpressure
+	chanFlush     chan chan struct{}
+	closed        chan struct{}
+	stopped       chan struct{}
+	closeOnce     sync.Once
+	written       uint64
+	dropped       uint64
+	sinks         []LogSink
 }
 
 // type logMessage struct {
@@ -162,63 +255,177 @@ type MxLog struct {
 // 	level int
 // }
 
-// SetMaxFileLife set max day log file keep
-// func (l *MxLog) SetMaxFileLife(c int64) {
-// 	l.expired = c*24*60*60 - 10
-// }
-
-// SetMaxFileCount [Discard] use SetMaxFileLife() instead
-// func (l *MxLog) SetMaxFileCount(c uint16) {
-// 	l.SetMaxFileLife(int64(c))
-// }
-
-// SetMaxFileSize set max log file size in M
-// func (l *MxLog) SetMaxFileSize(c int64) {
-// 	l.fileMaxSize = c * 1024000
-// }
-
 // DefaultWriter out
 func (l *MxLog) DefaultWriter() io.Writer {
 	return l.out
 }
 
-// SetLogLevel set file & console log level
-// func (l *MxLog) SetLogLevel(loglevel int, conlevel ...int) {
-// 	l.logLevel = loglevel
+// SetLevel 设置日志级别，可在运行中调用，级别<=10时同时输出到控制台
+func (l *MxLog) SetLevel(level int) {
+	if level < logDebug {
+		level = logDebug
+	}
+	atomic.StoreInt32(&l.logLevel, int32(level))
+}
+
+// Level 当前日志级别
+func (l *MxLog) Level() int {
+	return int(atomic.LoadInt32(&l.logLevel))
+}
 
-// 	if l.logLevel <= 10 {
-// 		l.out = io.MultiWriter(l.fno, os.Stdout)
-// 	} else {
-// 		l.out = io.MultiWriter(l.fno)
-// 	}
-// }
+// ModuleLevels 返回通过SetModuleLevel单独设置的子日志级别
+func (l *MxLog) ModuleLevels() map[string]int {
+	m := make(map[string]int)
+	l.moduleLevels.Range(func(k, v interface{}) bool {
+		m[k.(string)] = v.(int)
+		return true
+	})
+	return m
+}
 
 // WriteLog 写日志
 func (l *MxLog) WriteLog(msg string, level int) {
 	l.writeLog(msg, level)
 }
 
-func (l *MxLog) writeLog(msg string, level int, lock ...bool) {
-	// 更新文件
-	// l.rollingFile()
-	// 写日志
-	if level >= l.logLevel {
-		s := fmt.Sprintf(logformater, time.Now().Format(ShortTimeFormat), level, msg)
-		if level >= 40 && l.logLevel >= 20 {
-			println(s)
+func (l *MxLog) writeLog(msg string, level int, kv ...interface{}) {
+	if level >= l.Level() {
+		l.output("", level, msg, kv)
+	}
+}
+
+// output 格式化并写入日志，调用方负责级别判断
+//	name: 子日志名称，为空时不输出
+func (l *MxLog) output(name string, level int, msg string, kv []interface{}) {
+	var s, body string
+	t := time.Now()
+	if !l.jsonFormat || len(l.sinks) > 0 {
+		body = msg + formatLogKV(kv)
+		if name != "" {
+			body = "[" + name + "] " + body
+		}
+	}
+	if l.jsonFormat {
+		s = formatLogJSON(t, level, name, msg, kv)
+	} else {
+		s = fmt.Sprintf(logformater, t.Format(ShortTimeFormat), level, body)
+	}
+	if level >= 40 && l.Level() >= 20 {
+		println(s)
+	}
+	if l.logClassified {
+		s = logCryptoPrefix + l.cWorker.Encrypt(s)
+	}
+	l.enqueue(s)
+	if len(l.sinks) > 0 {
+		l.sendSinks(t, level, name, msg, body, s, kv)
+	}
+}
+
+// enqueue 按队列满处理方式将日志放入写入队列
+func (l *MxLog) enqueue(s string) {
+	select {
+	case <-l.closed:
+		atomic.AddUint64(&l.dropped, 1)
+		return
+	default:
+	}
+	switch l.backpressure {
+	case LogDropNewest:
+		select {
+		case l.chanWriteLog <- s:
+		default:
+			atomic.AddUint64(&l.dropped, 1)
+		}
+	case LogDropOldest:
+		for {
+			select {
+			case l.chanWriteLog <- s:
+				return
+			default:
+			}
+			select {
+			case <-l.chanWriteLog:
+				atomic.AddUint64(&l.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case l.chanWriteLog <- s:
+		case <-l.closed:
+			atomic.AddUint64(&l.dropped, 1)
+		}
+	}
+}
+
+// Flush 等待队列中已有的日志写入文件并同步到磁盘
+func (l *MxLog) Flush() {
+	done := make(chan struct{})
+	select {
+	case l.chanFlush <- done:
+		<-done
+	case <-l.stopped:
+	}
+}
+
+// Close 写完队列中的日志，同步到磁盘并关闭文件，之后写入的日志会被丢弃并计入Dropped
+func (l *MxLog) Close() {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	<-l.stopped
+}
+
+// Stats 返回日志写入统计
+func (l *MxLog) Stats() LogStats {
+	st := LogStats{
+		Written: atomic.LoadUint64(&l.written),
+		Dropped: atomic.LoadUint64(&l.dropped),
+		Queued:  len(l.chanWriteLog),
+	}
+	if len(l.sinks) > 0 {
+		st.SinkDropped = make([]uint64, len(l.sinks))
+		for k, sk := range l.sinks {
+			st.SinkDropped[k] = sk.Dropped()
+		}
+	}
+	return st
+}
+
+// With 返回附带固定字段的子日志，字段会附加在每条日志之后
+func (l *MxLog) With(kv ...interface{}) *MxChildLog {
+	return &MxChildLog{root: l, fields: kv}
+}
+
+// Named 返回指定名称的子日志，日志内容前会添加[name]，可通过SetModuleLevel单独设置级别
+func (l *MxLog) Named(name string) *MxChildLog {
+	return &MxChildLog{root: l, name: name}
+}
+
+// SetModuleLevel 设置子日志的最低级别，name为Named使用的完整名称，level<=0时恢复使用主日志级别
+func (l *MxLog) SetModuleLevel(name string, level int) {
+	if level <= 0 {
+		l.moduleLevels.Delete(name)
+		return
+	}
+	l.moduleLevels.Store(name, level)
+}
+
+// moduleLevel 获取子日志的最低级别，未单独设置时逐级向上查找，最终使用主日志级别
+//	如 mq.consumer 未设置时使用 mq 的级别
+func (l *MxLog) moduleLevel(name string) int {
+	for name != "" {
+		if v, ok := l.moduleLevels.Load(name); ok {
+			return v.(int)
 		}
-		if l.logClassified {
-			s = l.cWorker.EncryptNoTail(s)
+		idx := strings.LastIndex(name, ".")
+		if idx < 0 {
+			break
 		}
-		l.chanWriteLog <- s
-		// go func() {
-		// 	defer func() { recover() }()
-		// 	if l.logClassified {
-		// 		s = l.cWorker.EncryptNoTail(s)
-		// 	}
-		// 	fmt.Fprintln(l.out, s)
-		// }()
+		name = name[:idx]
 	}
+	return l.Level()
 }
 
 // Debug writelog with level 10
@@ -271,15 +478,30 @@ func (l *MxLog) SystemFormat(f string, msg ...interface{}) {
 	l.writeLog(fmt.Sprintf(f, msg...), logSystem)
 }
 
-// CurrentFileSize current file size
-// func (l *MxLog) CurrentFileSize() int64 {
-// 	return l.fileSize
-// }
+// DebugKV writelog with level 10 and key/value fields
+func (l *MxLog) DebugKV(msg string, kv ...interface{}) {
+	l.writeLog(msg, logDebug, kv...)
+}
 
-// EnableGZ EnableGZ
-// func (l *MxLog) EnableGZ(b bool) {
-// 	l.enablegz = b
-// }
+// InfoKV writelog with level 20 and key/value fields
+func (l *MxLog) InfoKV(msg string, kv ...interface{}) {
+	l.writeLog(msg, logInfo, kv...)
+}
+
+// WarningKV writelog with level 30 and key/value fields
+func (l *MxLog) WarningKV(msg string, kv ...interface{}) {
+	l.writeLog(msg, logWarning, kv...)
+}
+
+// ErrorKV writelog with level 40 and key/value fields
+func (l *MxLog) ErrorKV(msg string, kv ...interface{}) {
+	l.writeLog(msg, logError, kv...)
+}
+
+// SystemKV writelog with level 90 and key/value fields
+func (l *MxLog) SystemKV(msg string, kv ...interface{}) {
+	l.writeLog(msg, logSystem, kv...)
+}
 
 // InitNewLogger [Discard] use NewLogger() instead
 func InitNewLogger(p string) Logger {
@@ -287,184 +509,228 @@ func InitNewLogger(p string) Logger {
 }
 
 // NewLogger init logger
-// 日志保存路径，日志文件名，日志级别，日志保留天数
-func NewLogger(d, f string, logLevel, logDays int) Logger {
+// 日志保存路径，日志文件名，日志级别，日志保留天数，扩展配置（可选）
+func NewLogger(d, f string, logLevel, logDays int, opt ...LogOpt) Logger {
 	switch logLevel {
 	case 0:
 		return &NilLogger{}
 	case 1:
 		return &StdLogger{}
 	}
-	t := time.Now()
 	mylog := &MxLog{
-		expired:       int64(logDays)*24*60*60 - 10,
-		fileMaxSize:   maxFileSize,
 		fname:         f,
-		fileIndex:     0,
-		fileDay:       t.Day(),
-		fileHour:      t.Hour(),
 		logDir:        d,
-		logLevel:      logLevel,
-		chanWriteLog:  make(chan string, 100),
-		enablegz:      true,
+		logLevel:      int32(logLevel),
+		chanFlush:     make(chan chan struct{}),
+		closed:        make(chan struct{}),
+		stopped:       make(chan struct{}),
 		logClassified: false,
-		cWorker:       GetNewCryptoWorker(CryptoAES128CBC),
 	}
-	mylog.cWorker.SetKey(":@9j&%D5pA!ISE_P", "JTHp^#h#<2|bgL}e")
-	if IsExist(filepath.Join(GetExecDir(), ".safemode")) {
-		mylog.logClassified = true
+	var queueSize = 100
+	var keyFile, keyEnv string
+	var ro = RollingOpt{
+		Dir:      d,
+		Name:     f,
+		MaxDays:  logDays,
+		Compress: true,
 	}
-
-	for i := byte(255); i > 0; i-- {
-		if IsExist(filepath.Join(mylog.logDir, fmt.Sprintf("%s.%v.%d.log", mylog.fname, t.Format(FileTimeFormat), i))) {
-			mylog.fileIndex = i
+	if len(opt) > 0 {
+		ro.MaxSizeMB = opt[0].MaxSizeMB
+		ro.Interval = opt[0].RotateInterval
+		ro.MaxFiles = opt[0].MaxFiles
+		ro.NameFormat = opt[0].NameFormat
+		mylog.jsonFormat = opt[0].JSONFormat
+		mylog.backpressure = opt[0].Backpressure
+		if opt[0].QueueSize > 0 {
+			queueSize = opt[0].QueueSize
+		}
+		keyFile, keyEnv = opt[0].KeyFile, opt[0].KeyEnv
+		mylog.sinks = opt[0].Sinks
+	}
+	mylog.chanWriteLog = make(chan string, queueSize)
+	// 未设置密钥时，兼容旧版程序目录下的.safemode
+	if keyFile == "" && keyEnv == "" {
+		if safemode := filepath.Join(GetExecDir(), ".safemode"); IsExist(safemode) {
+			keyFile = safemode
+		}
+	}
+	var keyErr string
+	if keyFile != "" || keyEnv != "" {
+		if err := mylog.setCryptoKey(keyFile, keyEnv); err != nil {
+			// 要求加密但密钥无效时不写文件，避免明文落盘
+			keyErr = "Log crypto key error, log files are disabled: " + err.Error()
+			ro.Name = ""
+			mylog.fname = ""
 		}
 	}
-	mylog.newFile()
+
+	mylog.newFile(ro)
 
 	// 创建写入线程
-	go func() {
-		var locker sync.WaitGroup
-		locker.Add(1)
-	RUN:
-		go func() {
-			defer func() {
-				recover()
-				locker.Done()
-			}()
-			tc := time.NewTicker(time.Minute * 10)
-			for {
-				select {
-				case s := <-mylog.chanWriteLog:
-					fmt.Fprintln(mylog.out, s)
-				case <-tc.C:
-					mylog.rollingFile()
-				}
-			}
-		}()
-		locker.Wait()
-		goto RUN
-	}()
+	go mylog.writeLoop()
 
+	if keyErr != "" {
+		ioutil.WriteFile("logerr.log", []byte(keyErr), 0664)
+		fmt.Fprintln(os.Stderr, keyErr)
+		mylog.Error(keyErr)
+	}
 	return mylog
 }
 
-// 检查文件大小,返回是否需要切分文件
-func (l *MxLog) rolledWithFileSize() bool {
-	if l.fileHour == time.Now().Hour() {
-		return false
+// writeLoop 日志写入线程，异常退出后重新启动，Close后结束
+func (l *MxLog) writeLoop() {
+	defer close(l.stopped)
+	for !l.writeLines() {
+		time.Sleep(time.Second)
 	}
-	l.fileHour = time.Now().Hour()
-	fs, ex := os.Stat(l.pathNow)
-	if ex == nil {
-		if fs.Size() > l.fileMaxSize {
-			if l.fileIndex >= 255 {
-				l.fileIndex = 0
-			} else {
-				l.fileIndex++
+}
+
+func (l *MxLog) writeLines() (closed bool) {
+	defer func() { recover() }()
+	for {
+		select {
+		case s := <-l.chanWriteLog:
+			l.writeLine(s)
+		case done := <-l.chanFlush:
+			l.drain()
+			close(done)
+		case <-l.closed:
+			l.drain()
+			if l.rf != nil {
+				l.rf.Close()
+			}
+			for _, sk := range l.sinks {
+				sk.Close()
 			}
 			return true
 		}
 	}
-	return false
 }
 
-func (l *MxLog) rollingFileNoLock() bool {
-	t := time.Now()
-	l.rolledWithFileSize()
-	l.nameNow = fmt.Sprintf("%s.%v.%d.log", l.fname, t.Format(FileTimeFormat), l.fileIndex)
-	// 比对文件名，若不同则重新设置io
-	if l.nameNow == l.nameOld {
-		return false
-	}
-	// 关闭旧fno
-	l.fno.Close()
-	// 创建新日志
-	l.newFile()
-	// 清理旧日志
-	l.clearFile()
+func (l *MxLog) writeLine(s string) {
+	fmt.Fprintln(l.out, s)
+	atomic.AddUint64(&l.written, 1)
+}
 
-	return true
+// drain 写入队列中剩余的日志并同步文件
+func (l *MxLog) drain() {
+	for {
+		select {
+		case s := <-l.chanWriteLog:
+			l.writeLine(s)
+		default:
+			if l.rf != nil {
+				l.rf.Sync()
+			}
+			return
+		}
+	}
 }
 
-// 按日期切分文件
-func (l *MxLog) rollingFile() bool {
-	l.fileLock.Lock()
-	defer l.fileLock.Unlock()
+// newFile 创建日志文件，文件名为空或创建失败时输出到控制台
+func (l *MxLog) newFile(ro RollingOpt) {
+	if l.fname == "" {
+		l.out = io.MultiWriter(os.Stdout)
+		return
+	}
+	var err error
+	l.rf, err = NewRollingFile(ro)
+	if err != nil {
+		ioutil.WriteFile("logerr.log", []byte("Log file open error: "+err.Error()), 0664)
+		l.out = io.MultiWriter(os.Stdout)
+		return
+	}
+	l.out = io.MultiWriter(l.rf, &logConsole{l: l})
+}
 
-	return l.rollingFileNoLock()
+// logConsole debug级别时将日志同时输出到控制台，级别在写入时判断，以便SetLevel即时生效
+type logConsole struct {
+	l *MxLog
 }
 
-// 压缩旧日志
-func (l *MxLog) zipFile(s string) {
-	if !l.enablegz || len(s) == 0 || !IsExist(filepath.Join(l.logDir, s)) {
-		return
+func (c *logConsole) Write(p []byte) (int, error) {
+	if c.l.Level() <= logDebug {
+		return os.Stdout.Write(p)
 	}
-	go func(s string) {
-		err := ZIPFile(l.logDir, s, true)
-		if err != nil {
-			l.Error("zip log file error: " + s + " " + err.Error())
-			return
-		}
-	}(s)
+	return len(p), nil
+}
+
+// logLevelName 日志级别名称
+func logLevelName(level int) string {
+	switch {
+	case level >= logSystem:
+		return "system"
+	case level >= logError:
+		return "error"
+	case level >= logWarning:
+		return "warning"
+	case level >= logInfo:
+		return "info"
+	}
+	return "debug"
 }
 
-// 清理旧日志
-func (l *MxLog) clearFile() {
-	// 若未设置超时，则不清理
-	if l.expired == 0 {
-		return
+// logKVPair 取第i组key/value，key非字符串时转为字符串，缺少value时填充(MISSING)
+func logKVPair(kv []interface{}, i int) (string, interface{}) {
+	k, ok := kv[i].(string)
+	if !ok {
+		k = fmt.Sprint(kv[i])
+	}
+	if i+1 >= len(kv) {
+		return k, "(MISSING)"
+	}
+	switch v := kv[i+1].(type) {
+	case error:
+		return k, v.Error()
+	case fmt.Stringer:
+		return k, v.String()
+	default:
+		return k, v
 	}
-	go func() {
-		defer func() { recover() }()
-		// 遍历文件夹
-		lstfno, ex := ioutil.ReadDir(l.logDir)
-		if ex != nil {
-			println(fmt.Sprintf("clear log files error: %s", ex.Error()))
-			return
-		}
-		t := time.Now()
-		for _, fno := range lstfno {
-			if fno.IsDir() || !strings.Contains(fno.Name(), l.fname) { // 忽略目录，不含日志名的文件，以及当前文件
-				continue
-			}
-			// 比对文件生存期
-			if t.Unix()-fno.ModTime().Unix() >= l.expired {
-				os.Remove(filepath.Join(l.logDir, fno.Name()))
-			}
-		}
-	}()
 }
 
-// 创建新日志文件
-func (l *MxLog) newFile() {
-	t := time.Now()
-	if l.fileDay != t.Day() {
-		l.fileDay = t.Day()
-		l.fileIndex = 0
+// formatLogKV 将key/value格式化为 key=value 形式，含空格等字符的value会加引号
+func formatLogKV(kv []interface{}) string {
+	if len(kv) == 0 {
+		return ""
 	}
-	l.nameNow = fmt.Sprintf("%s.%v.%d.log", l.fname, t.Format(FileTimeFormat), l.fileIndex)
-	l.pathNow = filepath.Join(l.logDir, l.nameNow)
-	// 直接写入当日日志
-	if l.fname == "" {
-		l.out = io.MultiWriter(os.Stdout)
-	} else {
-		// 打开文件
-		l.fno, l.err = os.OpenFile(l.pathNow, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0664)
-		if l.err != nil {
-			ioutil.WriteFile("logerr.log", []byte("Log file open error: "+l.err.Error()), 0664)
-			l.out = io.MultiWriter(os.Stdout)
-		} else {
-			if l.logLevel <= 10 {
-				l.out = io.MultiWriter(l.fno, os.Stdout)
-			} else {
-				l.out = io.MultiWriter(l.fno)
-			}
+	var b strings.Builder
+	for i := 0; i < len(kv); i += 2 {
+		k, v := logKVPair(kv, i)
+		s := fmt.Sprint(v)
+		if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+			s = strconv.Quote(s)
 		}
-		// 判断是否压缩旧日志
-		if l.enablegz {
-			l.zipFile(l.nameOld)
+		b.WriteString(" " + k + "=" + s)
+	}
+	return b.String()
+}
+
+// formatLogJSON 将日志格式化为单行json，字段按传入顺序排列
+func formatLogJSON(t time.Time, level int, name, msg string, kv []interface{}) string {
+	var b bytes.Buffer
+	b.WriteString(`{"time":"` + t.Format(logJSONTimeFormat) + `","level":"` + logLevelName(level) + `",`)
+	if name != "" {
+		nb, _ := json.Marshal(name)
+		b.WriteString(`"logger":`)
+		b.Write(nb)
+		b.WriteByte(',')
+	}
+	b.WriteString(`"msg":`)
+	m, _ := json.Marshal(msg)
+	b.Write(m)
+	for i := 0; i < len(kv); i += 2 {
+		k, v := logKVPair(kv, i)
+		kb, _ := json.Marshal(k)
+		vb, err := json.Marshal(v)
+		if err != nil {
+			vb, _ = json.Marshal(fmt.Sprint(v))
 		}
+		b.WriteByte(',')
+		b.Write(kb)
+		b.WriteByte(':')
+		b.Write(vb)
 	}
-	l.nameOld = l.nameNow
+	b.WriteByte('}')
+	return b.String()
 }
@@ -0,0 +1,139 @@
+package gopsu
+
+import (
+	"fmt"
+	"io"
+)
+
+// MxChildLog MxLog的子日志，共享主日志的文件和写入线程，由MxLog.With，MxLog.Named创建
+//	可继续调用With，Named生成下一级子日志，通过SetLevel单独设置级别
+type MxChildLog struct {
+	root   *MxLog
+	name   string
+	fields []interface{}
+}
+
+// With 返回在当前字段基础上追加字段的子日志
+func (l *MxChildLog) With(kv ...interface{}) *MxChildLog {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+	return &MxChildLog{root: l.root, name: l.name, fields: fields}
+}
+
+// Named 返回下一级子日志，名称以.连接，如 mq.consumer
+func (l *MxChildLog) Named(name string) *MxChildLog {
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+	return &MxChildLog{root: l.root, name: name, fields: l.fields}
+}
+
+// Name 子日志的完整名称，未通过Named命名时为空
+func (l *MxChildLog) Name() string {
+	return l.name
+}
+
+// SetLevel 设置本子日志及其下级子日志的最低级别，等同于root.SetModuleLevel(Name(), level)
+//	level<=0时恢复使用上级或主日志的级别，未通过Named命名的子日志始终使用主日志级别，调用无效
+func (l *MxChildLog) SetLevel(level int) {
+	if l.name == "" {
+		return
+	}
+	l.root.SetModuleLevel(l.name, level)
+}
+
+// Level 本子日志当前生效的最低级别
+func (l *MxChildLog) Level() int {
+	return l.root.moduleLevel(l.name)
+}
+
+func (l *MxChildLog) writeLog(msg string, level int, kv []interface{}) {
+	if level < l.root.moduleLevel(l.name) {
+		return
+	}
+	if len(l.fields) > 0 {
+		kv = append(append(make([]interface{}, 0, len(l.fields)+len(kv)), l.fields...), kv...)
+	}
+	l.root.output(l.name, level, msg, kv)
+}
+
+// Debug writelog with level 10
+func (l *MxChildLog) Debug(msg string) {
+	l.writeLog(msg, logDebug, nil)
+}
+
+// Info writelog with level 20
+func (l *MxChildLog) Info(msg string) {
+	l.writeLog(msg, logInfo, nil)
+}
+
+// Warning writelog with level 30
+func (l *MxChildLog) Warning(msg string) {
+	l.writeLog(msg, logWarning, nil)
+}
+
+// Error writelog with level 40
+func (l *MxChildLog) Error(msg string) {
+	l.writeLog(msg, logError, nil)
+}
+
+// System writelog with level 90
+func (l *MxChildLog) System(msg string) {
+	l.writeLog(msg, logSystem, nil)
+}
+
+// DebugFormat writelog with level 10
+func (l *MxChildLog) DebugFormat(f string, msg ...interface{}) {
+	l.writeLog(fmt.Sprintf(f, msg...), logDebug, nil)
+}
+
+// InfoFormat writelog with level 20
+func (l *MxChildLog) InfoFormat(f string, msg ...interface{}) {
+	l.writeLog(fmt.Sprintf(f, msg...), logInfo, nil)
+}
+
+// WarningFormat writelog with level 30
+func (l *MxChildLog) WarningFormat(f string, msg ...interface{}) {
+	l.writeLog(fmt.Sprintf(f, msg...), logWarning, nil)
+}
+
+// ErrorFormat writelog with level 40
+func (l *MxChildLog) ErrorFormat(f string, msg ...interface{}) {
+	l.writeLog(fmt.Sprintf(f, msg...), logError, nil)
+}
+
+// SystemFormat writelog with level 90
+func (l *MxChildLog) SystemFormat(f string, msg ...interface{}) {
+	l.writeLog(fmt.Sprintf(f, msg...), logSystem, nil)
+}
+
+// DebugKV writelog with level 10 and key/value fields
+func (l *MxChildLog) DebugKV(msg string, kv ...interface{}) {
+	l.writeLog(msg, logDebug, kv)
+}
+
+// InfoKV writelog with level 20 and key/value fields
+func (l *MxChildLog) InfoKV(msg string, kv ...interface{}) {
+	l.writeLog(msg, logInfo, kv)
+}
+
+// WarningKV writelog with level 30 and key/value fields
+func (l *MxChildLog) WarningKV(msg string, kv ...interface{}) {
+	l.writeLog(msg, logWarning, kv)
+}
+
+// ErrorKV writelog with level 40 and key/value fields
+func (l *MxChildLog) ErrorKV(msg string, kv ...interface{}) {
+	l.writeLog(msg, logError, kv)
+}
+
+// SystemKV writelog with level 90 and key/value fields
+func (l *MxChildLog) SystemKV(msg string, kv ...interface{}) {
+	l.writeLog(msg, logSystem, kv)
+}
+
+// DefaultWriter 返回主日志的Writer
+func (l *MxChildLog) DefaultWriter() io.Writer {
+	return l.root.DefaultWriter()
+}
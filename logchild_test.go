@@ -0,0 +1,80 @@
+package gopsu
+
+import (
+	"strings"
+	"testing"
+)
+
+// newTestMxLog 不写文件的MxLog，日志留在队列中供检查
+func newTestMxLog(level int) *MxLog {
+	return &MxLog{
+		logLevel:     int32(level),
+		chanWriteLog: make(chan string, 100),
+		closed:       make(chan struct{}),
+	}
+}
+
+// queued 取出队列中的全部日志
+func (l *MxLog) queued() []string {
+	var ss []string
+	for {
+		select {
+		case s := <-l.chanWriteLog:
+			ss = append(ss, s)
+		default:
+			return ss
+		}
+	}
+}
+
+func TestMxChildLogLevels(t *testing.T) {
+	l := newTestMxLog(logInfo)
+	mq := l.Named("mq")
+	consumer := mq.Named("consumer").With("queue", "q1")
+	db := l.Named("db")
+	mq.SetLevel(logError)
+
+	cases := []struct {
+		log   *MxChildLog
+		level int
+		msg   string
+		want  string
+	}{
+		{consumer, logWarning, "consumer-warn", ""},
+		{consumer, logError, "consumer-err", "[mq.consumer] consumer-err queue=q1"},
+		{mq, logInfo, "mq-info", ""},
+		{db, logInfo, "db-info", "[db] db-info"},
+		{db, logDebug, "db-debug", ""},
+	}
+	for _, tc := range cases {
+		tc.log.writeLog(tc.msg, tc.level, nil)
+		got := l.queued()
+		if tc.want == "" {
+			if len(got) != 0 {
+				t.Errorf("%s: expected filtered, got %q", tc.msg, got)
+			}
+			continue
+		}
+		if len(got) != 1 || !strings.Contains(got[0], tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.msg, got, tc.want)
+		}
+	}
+	if consumer.Name() != "mq.consumer" || consumer.Level() != logError {
+		t.Errorf("consumer = %s %d", consumer.Name(), consumer.Level())
+	}
+
+	// 子级单独设置后优先于上级，恢复后重新继承
+	consumer.SetLevel(logDebug)
+	consumer.Debug("consumer-debug")
+	if got := l.queued(); len(got) != 1 {
+		t.Errorf("consumer debug after SetLevel: %q", got)
+	}
+	consumer.SetLevel(0)
+	if consumer.Level() != logError {
+		t.Errorf("consumer level after reset = %d", consumer.Level())
+	}
+	mq.SetLevel(0)
+	if consumer.Level() != logInfo {
+		t.Errorf("consumer level after mq reset = %d", consumer.Level())
+	}
+}
@@ -0,0 +1,137 @@
+package gopsu
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// logCryptoPrefix 加密日志行的前缀
+const logCryptoPrefix = "gcm:"
+
+// logPlainLine 未加密的日志行，文本格式以时间开头，json格式以{开头
+var logPlainLine = regexp.MustCompile(`^(\d{2}:\d{2}:\d{2}|\{)`)
+
+// setCryptoKey 读取密钥并开启日志加密
+func (l *MxLog) setCryptoKey(keyfile, env string) error {
+	key, err := LoadCryptoKey(keyfile, env)
+	if err != nil {
+		return err
+	}
+	l.cWorker = GetNewCryptoWorker(GCMCryptoType(key))
+	if err = l.cWorker.SetKey(string(key), ""); err != nil {
+		return err
+	}
+	l.logClassified = true
+	return nil
+}
+
+// legacyLogWorker 旧版.safemode使用的固定密钥，仅用于解密历史日志
+func legacyLogWorker() *CryptoWorker {
+	cw := GetNewCryptoWorker(CryptoAES128CBC)
+	cw.SetKey(":@9j&%D5pA!ISE_P", "JTHp^#h#<2|bgL}e")
+	return cw
+}
+
+// LogDecrypter 日志解密器
+type LogDecrypter struct {
+	cw     *CryptoWorker
+	legacy *CryptoWorker
+}
+
+// NewLogDecrypter 创建日志解密器
+//	key: 加密日志使用的密钥，参见LoadCryptoKey，为nil时只能解密旧版.safemode日志
+func NewLogDecrypter(key []byte) (*LogDecrypter, error) {
+	d := &LogDecrypter{
+		legacy: legacyLogWorker(),
+	}
+	if key != nil {
+		d.cw = GetNewCryptoWorker(GCMCryptoType(key))
+		if err := d.cw.SetKey(string(key), ""); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// DecryptLine 解密一行日志，未加密的行原样返回，无法解密时返回error
+func (d *LogDecrypter) DecryptLine(line string) (string, error) {
+	switch {
+	case strings.HasPrefix(line, logCryptoPrefix):
+		if d.cw == nil {
+			return line, fmt.Errorf("no key for encrypted line")
+		}
+		s := d.cw.Decrypt(line[len(logCryptoPrefix):])
+		if s == "" {
+			return line, fmt.Errorf("decrypt failed, wrong key or damaged line")
+		}
+		return s, nil
+	case line == "" || logPlainLine.MatchString(line):
+		return line, nil
+	}
+	// 旧版固定密钥加密的日志
+	if s := d.legacy.Decrypt(line); logPlainLine.MatchString(s) {
+		return s, nil
+	}
+	return line, fmt.Errorf("unknown line format")
+}
+
+// DecryptTo 逐行解密r中的日志并写入w，无法解密的行原样写入，返回无法解密的行数
+func (d *LogDecrypter) DecryptTo(w io.Writer, r io.Reader) (int, error) {
+	var failed int
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	bw := bufio.NewWriter(w)
+	for sc.Scan() {
+		s, err := d.DecryptLine(sc.Text())
+		if err != nil {
+			failed++
+		}
+		bw.WriteString(s)
+		bw.WriteByte('\n')
+	}
+	if err := sc.Err(); err != nil {
+		bw.Flush()
+		return failed, err
+	}
+	return failed, bw.Flush()
+}
+
+// DecryptLogFile 解密日志文件并写入w，支持.zip压缩的日志，返回无法解密的行数
+func DecryptLogFile(src string, w io.Writer, key []byte) (int, error) {
+	d, err := NewLogDecrypter(key)
+	if err != nil {
+		return 0, err
+	}
+	if strings.HasSuffix(src, ".zip") {
+		zr, err := zip.OpenReader(src)
+		if err != nil {
+			return 0, err
+		}
+		defer zr.Close()
+		var failed int
+		for _, zf := range zr.File {
+			r, err := zf.Open()
+			if err != nil {
+				return failed, err
+			}
+			n, err := d.DecryptTo(w, r)
+			r.Close()
+			failed += n
+			if err != nil {
+				return failed, err
+			}
+		}
+		return failed, nil
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return d.DecryptTo(w, f)
+}
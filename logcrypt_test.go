@@ -0,0 +1,122 @@
+package gopsu
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogCryptRoundTrip(t *testing.T) {
+	for _, size := range []int{16, 24, 32} {
+		keyfile := writeTestKey(t, 'k', size)
+		l := newTestMxLog(logInfo)
+		if err := l.setCryptoKey(keyfile, ""); err != nil {
+			t.Fatal(err)
+		}
+		l.Info("hello 中文")
+		l.ErrorKV("failed", "id", 3)
+		lines := l.queued()
+		if len(lines) != 2 {
+			t.Fatalf("queued %d lines", len(lines))
+		}
+		key, _ := LoadCryptoKey(keyfile, "")
+		d, err := NewLogDecrypter(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, want := range []string{"[20] hello 中文", "[40] failed id=3"} {
+			if !strings.HasPrefix(lines[k], logCryptoPrefix) || strings.Contains(lines[k], "hello") {
+				t.Errorf("key %d: line not encrypted: %q", size, lines[k])
+			}
+			s, err := d.DecryptLine(lines[k])
+			if err != nil || !strings.HasSuffix(s, want) {
+				t.Errorf("key %d: DecryptLine = %q, %v; want suffix %q", size, s, err, want)
+			}
+		}
+	}
+}
+
+func TestLogDecryptLine(t *testing.T) {
+	key := []byte(strings.Repeat("k", 32))
+	cw := GetNewCryptoWorker(GCMCryptoType(key))
+	cw.SetKey(string(key), "")
+	enc := logCryptoPrefix + cw.Encrypt("10:00:00.000 [20] secret")
+	d, _ := NewLogDecrypter(key)
+	other, _ := NewLogDecrypter([]byte(strings.Repeat("x", 32)))
+	nokey, _ := NewLogDecrypter(nil)
+	cases := []struct {
+		name string
+		d    *LogDecrypter
+		line string
+		want string
+		ok   bool
+	}{
+		{"encrypted", d, enc, "10:00:00.000 [20] secret", true},
+		{"wrong key", other, enc, enc, false},
+		{"no key", nokey, enc, enc, false},
+		{"tampered", d, enc[:len(enc)-4] + "AAAA", enc[:len(enc)-4] + "AAAA", false},
+		{"plain text", d, "10:00:00.000 [20] plain", "10:00:00.000 [20] plain", true},
+		{"plain json", nokey, `{"time":"x"}`, `{"time":"x"}`, true},
+		{"legacy", nokey, legacyLogWorker().Encrypt("10:00:00.000 [20] old"), "10:00:00.000 [20] old", true},
+		{"garbage", d, "not a log line", "not a log line", false},
+	}
+	for _, tc := range cases {
+		s, err := tc.d.DecryptLine(tc.line)
+		if s != tc.want || (err == nil) != tc.ok {
+			t.Errorf("%s: got %q, %v", tc.name, s, err)
+		}
+	}
+}
+
+func TestNewLoggerKeyFailClosed(t *testing.T) {
+	badKey := filepath.Join(t.TempDir(), "bad.key")
+	ioutil.WriteFile(badKey, []byte("short"), 0600)
+	// 密钥错误时会在当前目录写logerr.log，go test时GetExecDir也是当前目录
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(wd)
+	safemode := filepath.Join(GetExecDir(), ".safemode")
+	if IsExist(safemode) {
+		t.Skip(".safemode already exists in " + GetExecDir())
+	}
+	cases := []struct {
+		name     string
+		opt      LogOpt
+		safemode string
+		files    bool
+	}{
+		{"no key", LogOpt{}, "", true},
+		{"bad key file", LogOpt{KeyFile: badKey}, "", false},
+		{"empty safemode", LogOpt{}, " ", false},
+		{"valid safemode", LogOpt{}, hex.EncodeToString([]byte(strings.Repeat("k", 16))), true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.safemode != "" {
+				ioutil.WriteFile(safemode, []byte(strings.TrimSpace(tc.safemode)), 0600)
+				defer os.Remove(safemode)
+			}
+			dir := t.TempDir()
+			l := NewLogger(dir, "app", logInfo, 0, tc.opt).(*MxLog)
+			l.Info("secret")
+			l.Close()
+			lst, _ := ioutil.ReadDir(dir)
+			var found bool
+			for _, fi := range lst {
+				if strings.HasPrefix(fi.Name(), "app.") {
+					found = true
+					b, _ := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+					if tc.safemode != "" && strings.Contains(string(b), "secret") {
+						t.Errorf("plaintext written with safemode: %q", b)
+					}
+				}
+			}
+			if found != tc.files {
+				t.Errorf("log files written = %v, want %v", found, tc.files)
+			}
+		})
+	}
+}
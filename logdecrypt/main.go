@@ -0,0 +1,60 @@
+package main
+
+// 解密MxLog加密的日志文件
+//	logdecrypt -keyfile log.key name.210101.0.log [name.210101.1.log.zip ...] > plain.log
+//	logdecrypt -keyenv LOG_KEY -o plain.log name.210101.0.log
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/xyzj/gopsu"
+)
+
+var (
+	keyFile = flag.String("keyfile", "", "key file, hex or base64 encoded 16/24/32 bytes")
+	keyEnv  = flag.String("keyenv", "", "environment variable holding the key, takes precedence over -keyfile")
+	output  = flag.String("o", "", "output file, default stdout")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		println("usage: logdecrypt [-keyfile file|-keyenv name] [-o output] logfile...")
+		os.Exit(1)
+	}
+	var key []byte
+	if *keyFile != "" || *keyEnv != "" {
+		var err error
+		key, err = gopsu.LoadCryptoKey(*keyFile, *keyEnv)
+		if err != nil {
+			println(fmt.Sprintf("load key error. %s", err.Error()))
+			os.Exit(1)
+		}
+	}
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			println(fmt.Sprintf("create file error. %s", err.Error()))
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	var failed int
+	for _, src := range flag.Args() {
+		n, err := gopsu.DecryptLogFile(src, w, key)
+		failed += n
+		if err != nil {
+			println(fmt.Sprintf("decrypt %s error. %s", src, err.Error()))
+			os.Exit(1)
+		}
+	}
+	if failed > 0 {
+		println(fmt.Sprintf("%d lines could not be decrypted.", failed))
+		os.Exit(2)
+	}
+}
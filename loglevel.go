@@ -0,0 +1,81 @@
+package gopsu
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// logLevels 按详细程度排列的日志级别，用于信号逐级调整
+var logLevels = []int{logDebug, logInfo, logWarning, logError, logSystem}
+
+// ParseLogLevel 解析日志级别，支持数字（10,20,30,40,90）或名称（debug,info,warning,error,system）
+func ParseLogLevel(s string) (int, bool) {
+	s = strings.ToLower(TrimString(s))
+	switch s {
+	case "debug":
+		return logDebug, true
+	case "info":
+		return logInfo, true
+	case "warning", "warn":
+		return logWarning, true
+	case "error":
+		return logError, true
+	case "system":
+		return logSystem, true
+	}
+	if i, err := strconv.Atoi(s); err == nil && i >= logDebug {
+		return i, true
+	}
+	return 0, false
+}
+
+// stepLogLevel 将日志级别向更详细（step<0）或更简略（step>0）调整一级
+func stepLogLevel(level, step int) int {
+	idx := len(logLevels) - 1
+	for i, v := range logLevels {
+		if level <= v {
+			idx = i
+			break
+		}
+	}
+	idx += step
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(logLevels) {
+		idx = len(logLevels) - 1
+	}
+	return logLevels[idx]
+}
+
+// WatchLevelConf 定时检查配置文件，文件修改后重新读取并按key的值设置日志级别，ctx结束或调用stop后停止检查并取消订阅
+//	c: 配置文件
+//	key: 日志级别配置项，值为数字或级别名称
+//	interval: 检查间隔，最小1s
+//	ctx为context.Background()等不会结束的上下文时，必须在不再需要时调用返回的stop，否则检查协程不会退出
+func (l *MxLog) WatchLevelConf(ctx context.Context, c *ConfData, key string, interval time.Duration) (stop func()) {
+	ctx, stop = context.WithCancel(ctx)
+	l.applyConfLevel(c, key)
+	cancel := c.OnChange(key, func(old, new string) {
+		l.applyConfLevel(c, key)
+	})
+	c.Watch(ctx, interval)
+	go func() {
+		<-ctx.Done()
+		cancel()
+	}()
+	return stop
+}
+
+func (l *MxLog) applyConfLevel(c *ConfData, key string) {
+	v, err := c.GetItem(key)
+	if err != nil {
+		return
+	}
+	if level, ok := ParseLogLevel(v); ok && level != l.Level() {
+		l.SetLevel(level)
+		l.SystemKV("log level changed", "level", level, "by", "conf")
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package gopsu
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// WatchLevelSignal 监听信号调整日志级别，SIGUSR1输出更详细（如20->10），SIGUSR2输出更简略（如20->30）
+func (l *MxLog) WatchLevelSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range ch {
+			step := 1
+			if sig == syscall.SIGUSR1 {
+				step = -1
+			}
+			level := stepLogLevel(l.Level(), step)
+			l.SetLevel(level)
+			l.SystemKV("log level changed", "level", level, "by", sig.String())
+		}
+	}()
+}
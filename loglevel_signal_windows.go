@@ -0,0 +1,4 @@
+package gopsu
+
+// WatchLevelSignal windows不支持SIGUSR1/SIGUSR2，不做处理
+func (l *MxLog) WatchLevelSignal() {}
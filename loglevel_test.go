@@ -0,0 +1,61 @@
+package gopsu
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	cases := []struct {
+		s     string
+		level int
+		ok    bool
+	}{
+		{"10", logDebug, true},
+		{"debug", logDebug, true},
+		{"ERROR", logError, true},
+		{"30", logWarning, true},
+		{"verbose", 0, false},
+	}
+	for _, tc := range cases {
+		level, ok := ParseLogLevel(tc.s)
+		if ok != tc.ok || (ok && level != tc.level) {
+			t.Errorf("ParseLogLevel(%q) = %d, %v; want %d, %v", tc.s, level, ok, tc.level, tc.ok)
+		}
+	}
+}
+
+func TestWatchLevelConfStop(t *testing.T) {
+	c := loadTestConf(t, "level.conf", "log_level=20\n")
+	l := newTestMxLog(logInfo)
+	// 修改配置文件，修改时间向后调整以确保被检测到
+	set := func(s string, at time.Time) {
+		if err := ioutil.WriteFile(c.FullPath(), []byte("log_level="+s+"\n"), 0664); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(c.FullPath(), at, at)
+	}
+	wait := func(level int) bool {
+		for i := 0; i < 30; i++ {
+			if l.Level() == level {
+				return true
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		return false
+	}
+	stop := l.WatchLevelConf(context.Background(), c, "log_level", time.Second)
+	set("error", time.Now().Add(time.Minute))
+	if !wait(logError) {
+		t.Fatalf("level = %d after conf change, want %d", l.Level(), logError)
+	}
+	l.queued()
+	stop()
+	set("debug", time.Now().Add(2*time.Minute))
+	if wait(logDebug) {
+		t.Fatal("level changed after stop")
+	}
+}
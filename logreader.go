@@ -0,0 +1,434 @@
+package gopsu
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// logTextHead 文本格式日志行的开头 15:04:05.000 [20]
+var logTextHead = regexp.MustCompile(`^(\d{2}:\d{2}:\d{2}\.\d{3}) \[(\d+)\] `)
+
+// LogQuery 日志查询条件
+type LogQuery struct {
+	// Dir 日志文件夹
+	Dir string
+	// Name 日志名称，即NewLogger的f参数
+	Name string
+	// Start 开始时间（含），为零值时不限制
+	Start time.Time
+	// End 结束时间（不含），为零值时不限制
+	End time.Time
+	// Level 最低日志级别，0-不限制
+	Level int
+	// Grep 正则表达式，只返回匹配的日志，为空时不限制
+	Grep string
+	// Key 加密日志使用的密钥，参见LoadCryptoKey，为nil时只能解密旧版.safemode日志
+	Key []byte
+	// NameFormat 日志文件命名方法，需与写入时的LogOpt.NameFormat一致，默认DefaultRollingName
+	NameFormat func(name, period string, idx int) string
+}
+
+// LogRecord 一条日志，包含后续不以时间开头的行（如调用栈）
+type LogRecord struct {
+	Time  time.Time
+	Level int
+	// Text 解密后的日志内容，多行时以\n分隔
+	Text string
+	// File 所在文件路径
+	File string
+}
+
+// LogFile 日志文件信息
+type LogFile struct {
+	Path string
+	// Start 文件对应周期的开始时间，文件名不包含周期时为文件修改日期的0点
+	Start time.Time
+	// End 文件对应周期的结束时间，文件名不包含周期时为文件修改时间
+	End   time.Time
+	Index int
+}
+
+// LogReader 日志读取器，支持MxLog按NameFormat生成的文件以及zip压缩的旧文件，按天和按小时切分的文件均可读取
+type LogReader struct {
+	q     LogQuery
+	grep  *regexp.Regexp
+	dec   *LogDecrypter
+	names []*logNameRule
+}
+
+// logNameRule 与RollingFile相同的文件名规则，每种切分周期一条
+type logNameRule struct {
+	opt     RollingOpt
+	pattern *regexp.Regexp
+	layout  string
+}
+
+// NewLogReader 创建日志读取器
+func NewLogReader(q LogQuery) (*LogReader, error) {
+	if q.NameFormat == nil {
+		q.NameFormat = DefaultRollingName
+	}
+	r := &LogReader{
+		q: q,
+	}
+	for _, iv := range []RotateInterval{RotateDaily, RotateHourly} {
+		opt := RollingOpt{Name: q.Name, Interval: iv, NameFormat: q.NameFormat}
+		rule := &logNameRule{opt: opt, pattern: opt.namePattern(), layout: FileTimeFormat}
+		if iv == RotateHourly {
+			rule.layout = FileTimeFormat + "15"
+		}
+		r.names = append(r.names, rule)
+	}
+	var err error
+	if q.Grep != "" {
+		if r.grep, err = regexp.Compile(q.Grep); err != nil {
+			return nil, err
+		}
+	}
+	if r.dec, err = NewLogDecrypter(q.Key); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Files 查询时间范围内的日志文件，按时间和序号排序
+func (r *LogReader) Files() ([]*LogFile, error) {
+	return r.listFiles(r.q.Start, r.q.End)
+}
+
+func (r *LogReader) listFiles(start, end time.Time) ([]*LogFile, error) {
+	lstfno, err := ioutil.ReadDir(r.q.Dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*LogFile, 0)
+	for _, fno := range lstfno {
+		if fno.IsDir() {
+			continue
+		}
+		lf := r.parseName(fno)
+		if lf == nil {
+			continue
+		}
+		if (!start.IsZero() && !lf.End.After(start)) || (!end.IsZero() && !lf.Start.Before(end)) {
+			continue
+		}
+		files = append(files, lf)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Start.Equal(files[j].Start) {
+			return files[i].Index < files[j].Index
+		}
+		return files[i].Start.Before(files[j].Start)
+	})
+	return files, nil
+}
+
+// parseName 按文件名规则解析文件的周期和序号，不是本日志的文件返回nil
+func (r *LogReader) parseName(fno os.FileInfo) *LogFile {
+	for _, rule := range r.names {
+		period, idx, ok := rule.opt.matchName(rule.pattern, fno.Name())
+		if !ok {
+			continue
+		}
+		lf := &LogFile{
+			Path:  filepath.Join(r.q.Dir, fno.Name()),
+			Index: idx,
+		}
+		if period == "" {
+			// 无法从文件名得知周期，以修改时间估算
+			t := fno.ModTime()
+			lf.Start = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+			lf.End = t
+			return lf
+		}
+		start, err := time.ParseInLocation(rule.layout, period, time.Local)
+		if err != nil {
+			return nil
+		}
+		lf.Start = start
+		if rule.opt.Interval == RotateHourly {
+			lf.End = start.Add(time.Hour)
+		} else {
+			lf.End = start.AddDate(0, 0, 1)
+		}
+		return lf
+	}
+	return nil
+}
+
+// Each 按时间顺序遍历符合条件的日志，fn返回false时停止
+func (r *LogReader) Each(fn func(rec *LogRecord) bool) error {
+	files, err := r.Files()
+	if err != nil {
+		return err
+	}
+	for _, lf := range files {
+		goon, err := r.readFile(lf, fn)
+		if err != nil {
+			return err
+		}
+		if !goon {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Tail 返回符合条件的最后n条日志，按时间顺序排列
+func (r *LogReader) Tail(n int) ([]*LogRecord, error) {
+	if n <= 0 {
+		return []*LogRecord{}, nil
+	}
+	files, err := r.Files()
+	if err != nil {
+		return nil, err
+	}
+	// n来自调用方，不按n预分配，随读取到的日志增长
+	var recs = make([]*LogRecord, 0)
+	// 从最新的文件向前读取，直到数量足够
+	for i := len(files) - 1; i >= 0 && len(recs) < n; i-- {
+		// 环形缓存只保留文件中最后need条，避免大文件全部读入内存
+		need := n - len(recs)
+		ring := make([]*LogRecord, 0)
+		var count int
+		if _, err := r.readFile(files[i], func(rec *LogRecord) bool {
+			if len(ring) < need {
+				ring = append(ring, rec)
+			} else {
+				ring[count%need] = rec
+			}
+			count++
+			return true
+		}); err != nil {
+			return nil, err
+		}
+		var part []*LogRecord
+		if count <= need {
+			part = ring[:count]
+		} else {
+			idx := count % need
+			part = append(append(make([]*LogRecord, 0, need), ring[idx:]...), ring[:idx]...)
+		}
+		recs = append(part, recs...)
+	}
+	return recs, nil
+}
+
+// Follow 持续读取最新日志文件中新写入的内容，直到ctx结束或fn返回false
+//	interval: 检查间隔，默认1s
+func (r *LogReader) Follow(ctx context.Context, interval time.Duration, fn func(rec *LogRecord) bool) error {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	var cur *LogFile
+	var offset int64
+	// 从当前文件末尾开始
+	if lf := r.newest(); lf != nil {
+		cur = lf
+		if fs, err := os.Stat(lf.Path); err == nil {
+			offset = fs.Size()
+		}
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+		lf := r.newest()
+		if lf == nil {
+			continue
+		}
+		if cur != nil && cur.Path != lf.Path {
+			// 文件已切换，先读完旧文件剩余内容
+			if goon, _ := r.readFrom(cur, &offset, fn); !goon {
+				return nil
+			}
+			offset = 0
+		}
+		cur = lf
+		goon, err := r.readFrom(cur, &offset, fn)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if !goon {
+			return nil
+		}
+	}
+}
+
+// newest 最新的未压缩日志文件
+func (r *LogReader) newest() *LogFile {
+	files, _ := r.listFiles(time.Time{}, time.Time{})
+	for i := len(files) - 1; i >= 0; i-- {
+		if !strings.HasSuffix(files[i].Path, ".zip") {
+			return files[i]
+		}
+	}
+	return nil
+}
+
+// readFrom 从offset开始读取完整的行，并更新offset
+func (r *LogReader) readFrom(lf *LogFile, offset *int64, fn func(rec *LogRecord) bool) (bool, error) {
+	f, err := os.Open(lf.Path)
+	if err != nil {
+		return true, err
+	}
+	defer f.Close()
+	if fs, err := f.Stat(); err == nil && fs.Size() < *offset {
+		// 文件被截断
+		*offset = 0
+	}
+	if _, err = f.Seek(*offset, io.SeekStart); err != nil {
+		return true, err
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return true, err
+	}
+	// 只处理完整的行，剩余部分下次读取
+	idx := strings.LastIndexByte(string(b), '\n')
+	if idx < 0 {
+		return true, nil
+	}
+	*offset += int64(idx + 1)
+	return r.scan(lf, strings.NewReader(string(b[:idx+1])), fn)
+}
+
+// readFile 读取一个日志文件，zip文件读取其中的所有文件
+func (r *LogReader) readFile(lf *LogFile, fn func(rec *LogRecord) bool) (bool, error) {
+	if strings.HasSuffix(lf.Path, ".zip") {
+		zr, err := zip.OpenReader(lf.Path)
+		if err != nil {
+			return false, err
+		}
+		defer zr.Close()
+		for _, zf := range zr.File {
+			f, err := zf.Open()
+			if err != nil {
+				return false, err
+			}
+			goon, err := r.scan(lf, f, fn)
+			f.Close()
+			if err != nil || !goon {
+				return goon, err
+			}
+		}
+		return true, nil
+	}
+	f, err := os.Open(lf.Path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	return r.scan(lf, f, fn)
+}
+
+// scan 逐行解析日志，不以时间开头的行并入上一条日志
+func (r *LogReader) scan(lf *LogFile, rd io.Reader, fn func(rec *LogRecord) bool) (bool, error) {
+	var last *LogRecord
+	var prev = lf.Start
+	emit := func() bool {
+		if last == nil {
+			return true
+		}
+		rec := last
+		last = nil
+		if !r.match(rec) {
+			return true
+		}
+		return fn(rec)
+	}
+	sc := bufio.NewScanner(rd)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line, err := r.dec.DecryptLine(sc.Text())
+		if line == "" {
+			continue
+		}
+		rec := r.parseLine(lf, prev, line)
+		if rec == nil && err != nil && strings.HasPrefix(line, logCryptoPrefix) {
+			// 无法解密的行单独作为一条，级别未知
+			rec = &LogRecord{Time: prev, Text: line, File: lf.Path}
+		}
+		if rec == nil {
+			if last != nil {
+				last.Text += "\n" + line
+				continue
+			}
+			rec = &LogRecord{Time: prev, Text: line, File: lf.Path}
+		}
+		if !emit() {
+			return false, nil
+		}
+		last = rec
+		prev = rec.Time
+	}
+	if err := sc.Err(); err != nil {
+		return false, err
+	}
+	return emit(), nil
+}
+
+// parseLine 解析日志行的时间和级别，不是日志开头时返回nil
+func (r *LogReader) parseLine(lf *LogFile, prev time.Time, line string) *LogRecord {
+	if m := logTextHead.FindStringSubmatch(line); m != nil {
+		tod, err := time.ParseInLocation(ShortTimeFormat, m[1], time.Local)
+		if err != nil {
+			return nil
+		}
+		t := time.Date(lf.Start.Year(), lf.Start.Month(), lf.Start.Day(), tod.Hour(), tod.Minute(), tod.Second(), tod.Nanosecond(), time.Local)
+		// 跨天写入同一文件时，时间会小于上一条
+		if t.Before(prev.Add(-time.Hour)) {
+			t = t.AddDate(0, 0, 1)
+		}
+		level, _ := strconv.Atoi(m[2])
+		return &LogRecord{Time: t, Level: level, Text: line, File: lf.Path}
+	}
+	if strings.HasPrefix(line, "{") {
+		var v struct {
+			Time  string `json:"time"`
+			Level string `json:"level"`
+		}
+		if json.UnmarshalFromString(line, &v) != nil {
+			return nil
+		}
+		t, err := time.Parse(logJSONTimeFormat, v.Time)
+		if err != nil {
+			return nil
+		}
+		level, _ := ParseLogLevel(v.Level)
+		return &LogRecord{Time: t, Level: level, Text: line, File: lf.Path}
+	}
+	return nil
+}
+
+// match 判断日志是否符合查询条件
+func (r *LogReader) match(rec *LogRecord) bool {
+	if r.q.Level > 0 && rec.Level < r.q.Level {
+		return false
+	}
+	if !r.q.Start.IsZero() && rec.Time.Before(r.q.Start) {
+		return false
+	}
+	if !r.q.End.IsZero() && !rec.Time.Before(r.q.End) {
+		return false
+	}
+	if r.grep != nil && !r.grep.MatchString(rec.Text) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package gopsu
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestLogs 在dir下按format写入两个文件，每个文件5条日志
+func writeTestLogs(t *testing.T, dir string, format func(name, period string, idx int) string) {
+	period := time.Now().Format(FileTimeFormat)
+	for idx := 0; idx < 2; idx++ {
+		var sb strings.Builder
+		for i := 0; i < 5; i++ {
+			fmt.Fprintf(&sb, "10:00:%02d.000 [20] msg-%d\n", idx*5+i, idx*5+i)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, format("app", period, idx)), []byte(sb.String()), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 其他日志的文件不应被读取
+	ioutil.WriteFile(filepath.Join(dir, format("other", period, 0)), []byte("10:00:00.000 [20] other\n"), 0664)
+}
+
+func TestLogReaderNameFormat(t *testing.T) {
+	cases := []struct {
+		name   string
+		format func(name, period string, idx int) string
+	}{
+		{"default", nil},
+		{"custom", func(name, period string, idx int) string {
+			return fmt.Sprintf("%s-%d-%s.txt", name, idx, period)
+		}},
+		{"no-period", func(name, period string, idx int) string {
+			return fmt.Sprintf("%s_%03d.log", name, idx)
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			format := tc.format
+			if format == nil {
+				format = DefaultRollingName
+			}
+			writeTestLogs(t, dir, format)
+			r, err := NewLogReader(LogQuery{Dir: dir, Name: "app", NameFormat: tc.format})
+			if err != nil {
+				t.Fatal(err)
+			}
+			files, err := r.Files()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 2 || files[0].Index != 0 || files[1].Index != 1 {
+				t.Fatalf("files = %v", files)
+			}
+			for _, n := range []int{3, 7, 10, 1 << 40} {
+				recs, err := r.Tail(n)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := n
+				if want > 10 {
+					want = 10
+				}
+				if len(recs) != want {
+					t.Fatalf("Tail(%d) returned %d records", n, len(recs))
+				}
+				for i, rec := range recs {
+					if s := fmt.Sprintf("msg-%d", 10-want+i); !strings.HasSuffix(rec.Text, s) {
+						t.Errorf("Tail(%d)[%d] = %q, want %s", n, i, rec.Text, s)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package gopsu
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// logSinkBuffer 远程输出默认缓存行数
+	logSinkBuffer = 10000
+	// logSinkTimeout 连接及写入超时
+	logSinkTimeout = time.Second * 5
+	// logSinkMaxBackoff 重连最大间隔
+	logSinkMaxBackoff = time.Second * 30
+	// logSyslogTimeFormat rfc5424时间格式，小数最多6位
+	logSyslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// LogEntry 发送给远程输出的日志
+type LogEntry struct {
+	Time  time.Time
+	Level int
+	// Msg 不含时间和级别的日志内容，加密模式下为加密后的日志行
+	Msg string
+	// JSON json格式日志行，加密模式下只包含time，level和enc字段
+	JSON string
+}
+
+// LogSink 远程日志输出，WriteEntry不应阻塞
+type LogSink interface {
+	WriteEntry(e *LogEntry)
+	// Dropped 因缓存已满，已关闭或发送不完整而丢弃的日志数量
+	Dropped() uint64
+	Close() error
+}
+
+// sendSinks 将日志发送到所有远程输出，加密模式下不发送明文
+func (l *MxLog) sendSinks(t time.Time, level int, name, msg, body, line string, kv []interface{}) {
+	e := &LogEntry{
+		Time:  t,
+		Level: level,
+		Msg:   body,
+	}
+	switch {
+	case l.logClassified:
+		e.Msg = line
+		enc, _ := json.Marshal(line)
+		e.JSON = `{"time":"` + t.Format(logJSONTimeFormat) + `","level":"` + logLevelName(level) + `","enc":` + string(enc) + `}`
+	case l.jsonFormat:
+		e.JSON = line
+	default:
+		e.JSON = formatLogJSON(t, level, name, msg, kv)
+	}
+	for _, sk := range l.sinks {
+		sk.WriteEntry(e)
+	}
+}
+
+// netSink 带缓存和自动重连的网络输出
+type netSink struct {
+	network   string
+	addr      string
+	format    func(e *LogEntry) []byte
+	queue     chan []byte
+	dropped   uint64
+	closed    chan struct{}
+	closeOnce sync.Once
+	stopped   chan struct{}
+}
+
+func newNetSink(network, addr string, format func(e *LogEntry) []byte) *netSink {
+	s := &netSink{
+		network: network,
+		addr:    addr,
+		format:  format,
+		queue:   make(chan []byte, logSinkBuffer),
+		closed:  make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// WriteEntry 放入发送缓存，缓存已满时丢弃最早的日志
+func (s *netSink) WriteEntry(e *LogEntry) {
+	select {
+	case <-s.closed:
+		atomic.AddUint64(&s.dropped, 1)
+		return
+	default:
+	}
+	b := s.format(e)
+	for {
+		select {
+		case s.queue <- b:
+			return
+		default:
+		}
+		select {
+		case <-s.queue:
+			atomic.AddUint64(&s.dropped, 1)
+		default:
+		}
+	}
+}
+
+// Dropped 因缓存已满，已关闭或发送不完整而丢弃的日志数量
+func (s *netSink) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close 尝试在超时时间内发送剩余缓存后关闭连接
+func (s *netSink) Close() error {
+	s.closeOnce.Do(func() { close(s.closed) })
+	select {
+	case <-s.stopped:
+	case <-time.After(logSinkTimeout):
+	}
+	return nil
+}
+
+func (s *netSink) run() {
+	defer close(s.stopped)
+	var conn net.Conn
+	var pending []byte
+	var backoff = time.Second
+	var closing = false
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	for {
+		if pending == nil {
+			if closing {
+				// 关闭时只发送剩余缓存，不再等待
+				select {
+				case pending = <-s.queue:
+				default:
+					return
+				}
+			} else {
+				select {
+				case pending = <-s.queue:
+				case <-s.closed:
+					closing = true
+					continue
+				}
+			}
+		}
+		if conn == nil {
+			var err error
+			conn, err = net.DialTimeout(s.network, s.addr, logSinkTimeout)
+			if err != nil {
+				conn = nil
+				if closing {
+					return
+				}
+				select {
+				case <-time.After(backoff):
+				case <-s.closed:
+					closing = true
+				}
+				if backoff *= 2; backoff > logSinkMaxBackoff {
+					backoff = logSinkMaxBackoff
+				}
+				continue
+			}
+			backoff = time.Second
+		}
+		conn.SetWriteDeadline(time.Now().Add(logSinkTimeout))
+		if n, err := conn.Write(pending); err != nil {
+			conn.Close()
+			conn = nil
+			// 未写出任何内容时重连后重发，已写出部分时对方收到的帧不完整，丢弃该条日志，
+			// 避免重发后rfc6587长度前缀与内容错位
+			if n > 0 {
+				atomic.AddUint64(&s.dropped, 1)
+				pending = nil
+			}
+			continue
+		}
+		pending = nil
+	}
+}
+
+// isStreamNetwork 是否为流式连接，流式连接需要分帧
+func isStreamNetwork(network string) bool {
+	return strings.HasPrefix(network, "tcp") || network == "unix"
+}
+
+// NewSyslogSink 创建rfc5424格式的syslog输出
+//	network: udp，tcp，unix（流式）或unixgram，tcp和unix使用rfc6587长度前缀分帧
+//	addr: 如 127.0.0.1:514，/dev/log
+//	app: 应用名称，为空时使用程序名
+//	facility: syslog facility，如16（local0）
+func NewSyslogSink(network, addr, app string, facility int) LogSink {
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "-"
+	}
+	if app == "" {
+		app = GetExecName()
+	}
+	app = strings.Replace(app, " ", "_", -1)
+	pid := strconv.Itoa(os.Getpid())
+	stream := isStreamNetwork(network)
+	return newNetSink(network, addr, func(e *LogEntry) []byte {
+		msg := fmt.Sprintf("<%d>1 %s %s %s %s - - %s", facility*8+syslogSeverity(e.Level), e.Time.Format(logSyslogTimeFormat), host, app, pid, e.Msg)
+		if stream {
+			return []byte(strconv.Itoa(len(msg)) + " " + msg)
+		}
+		return []byte(msg)
+	})
+}
+
+// syslogSeverity 日志级别对应的syslog severity
+func syslogSeverity(level int) int {
+	switch {
+	case level >= logSystem:
+		return 5 // notice
+	case level >= logError:
+		return 3
+	case level >= logWarning:
+		return 4
+	case level >= logInfo:
+		return 6
+	}
+	return 7
+}
+
+// NewJSONSink 创建按行发送json的输出，每行附加host字段
+//	network: tcp，udp，unix等
+//	addr: 日志收集服务地址
+func NewJSONSink(network, addr string) LogSink {
+	host, _ := os.Hostname()
+	hb, _ := json.Marshal(host)
+	prefix := []byte(`{"host":` + string(hb) + `,`)
+	return newNetSink(network, addr, func(e *LogEntry) []byte {
+		var b bytes.Buffer
+		b.Write(prefix)
+		b.WriteString(e.JSON[1:])
+		b.WriteByte('\n')
+		return b.Bytes()
+	})
+}
@@ -0,0 +1,92 @@
+package gopsu
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSyslogSinkTCPFraming(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	got := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rd := bufio.NewReader(conn)
+		for {
+			// rfc6587: 长度 空格 内容
+			s, err := rd.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				got <- "bad frame: " + s
+				return
+			}
+			b := make([]byte, n)
+			if _, err := io.ReadFull(rd, b); err != nil {
+				return
+			}
+			got <- string(b)
+		}
+	}()
+	sk := NewSyslogSink("tcp", ln.Addr().String(), "app", 16)
+	msgs := []struct {
+		level int
+		msg   string
+		want  string
+	}{
+		{logInfo, "hello world", "<134>1 "},
+		{logError, "boom", "<131>1 "},
+		{logSystem, "start", "<133>1 "},
+	}
+	for _, m := range msgs {
+		sk.WriteEntry(&LogEntry{Time: time.Now(), Level: m.level, Msg: m.msg})
+	}
+	for _, m := range msgs {
+		select {
+		case s := <-got:
+			if !strings.HasPrefix(s, m.want) || !strings.HasSuffix(s, " app "+strconv.Itoa(os.Getpid())+" - - "+m.msg) {
+				t.Errorf("got %q, want prefix %q and msg %q", s, m.want, m.msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for syslog message")
+		}
+	}
+	sk.Close()
+	if sk.Dropped() != 0 {
+		t.Errorf("dropped = %d", sk.Dropped())
+	}
+}
+
+func TestNetSinkConcurrentClose(t *testing.T) {
+	// 无法连接的地址，Close不等待发送
+	sk := NewJSONSink("tcp", "127.0.0.1:1")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sk.Close()
+		}()
+	}
+	wg.Wait()
+	sk.WriteEntry(&LogEntry{Time: time.Now(), Level: logInfo, JSON: `{"msg":"x"}`})
+	if sk.Dropped() != 1 {
+		t.Errorf("dropped after close = %d", sk.Dropped())
+	}
+}
@@ -0,0 +1,320 @@
+package gopsu
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateInterval 日志文件按时间切分的周期
+type RotateInterval byte
+
+const (
+	// RotateDaily 每天切分
+	RotateDaily RotateInterval = iota
+	// RotateHourly 每小时切分
+	RotateHourly
+)
+
+// 用于从NameFormat推导文件名规则的占位值
+const (
+	rollingPeriodMark = "\x00period\x00"
+	rollingIndexMark  = 1073741831
+)
+
+// RollingOpt 滚动文件配置
+type RollingOpt struct {
+	// Dir 文件夹
+	Dir string
+	// Name 文件名，实际文件名由NameFormat生成
+	Name string
+	// MaxSizeMB 单个文件最大大小（MB），超过后切分新文件，默认1000
+	MaxSizeMB int64
+	// Interval 按时间切分的周期，默认RotateDaily
+	Interval RotateInterval
+	// MaxDays 文件保留天数，0-不按时间清理
+	MaxDays int
+	// MaxFiles 最多保留的文件数量（含压缩文件），0-不限制
+	MaxFiles int
+	// Compress 是否将切分下来的旧文件压缩为zip
+	Compress bool
+	// NameFormat 文件命名方法，默认 name.060102.0.log（按小时切分时为 name.06010215.0.log）
+	//	period为按Interval格式化的时间，idx为同一周期内的文件序号，从0开始
+	//	生成的文件名必须随idx变化，否则无法按大小切分，NewRollingFile会返回错误；可以不包含period
+	NameFormat func(name, period string, idx int) string
+}
+
+// DefaultRollingName 默认文件命名方法 name.period.idx.log
+func DefaultRollingName(name, period string, idx int) string {
+	return fmt.Sprintf("%s.%s.%d.log", name, period, idx)
+}
+
+// RollingFile 按大小和时间自动切分的文件，可并发写入
+type RollingFile struct {
+	opt     RollingOpt
+	maxSize int64
+	locker  sync.Mutex
+	fno     *os.File
+	size    int64
+	period  string
+	index   int
+	nameNow string
+	closed  bool
+	// pattern 匹配本文件切分出的文件名（含.zip），子匹配为周期和序号
+	pattern *regexp.Regexp
+}
+
+// NewRollingFile 创建滚动文件，若当前周期已有文件，则继续写入序号最大的文件
+func NewRollingFile(opt RollingOpt) (*RollingFile, error) {
+	if opt.MaxSizeMB <= 0 {
+		opt.MaxSizeMB = 1000
+	}
+	if opt.NameFormat == nil {
+		opt.NameFormat = DefaultRollingName
+	}
+	// 文件名不随序号变化时，切分时查找可用序号会陷入死循环
+	if name := opt.NameFormat(opt.Name, opt.periodOf(time.Now()), 0); name == opt.NameFormat(opt.Name, opt.periodOf(time.Now()), 1) {
+		return nil, fmt.Errorf("rolling file NameFormat must use idx: %s", name)
+	}
+	if err := os.MkdirAll(opt.Dir, 0775); err != nil {
+		return nil, err
+	}
+	r := &RollingFile{
+		opt:     opt,
+		maxSize: opt.MaxSizeMB * 1024 * 1024,
+		period:  opt.periodOf(time.Now()),
+		pattern: opt.namePattern(),
+	}
+	r.index = r.lastIndex()
+	// 序号最大的文件已被压缩时不再续写
+	for IsExist(r.fileName(r.index) + ".zip") {
+		r.index++
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	go r.clean()
+	return r, nil
+}
+
+// lastIndex 查找当前周期已有文件的最大序号，旧文件可能已被清理，因此序号不一定从0开始
+func (r *RollingFile) lastIndex() int {
+	lstfno, err := ioutil.ReadDir(r.opt.Dir)
+	if err != nil {
+		return 0
+	}
+	var last = 0
+	for _, fno := range lstfno {
+		period, idx, ok := r.match(fno.Name())
+		// 文件名不包含周期时，所有文件共用一组序号
+		if ok && (period == r.period || period == "") && idx > last {
+			last = idx
+		}
+	}
+	return last
+}
+
+// namePattern 按NameFormat生成的文件名推导匹配规则
+func (o *RollingOpt) namePattern() *regexp.Regexp {
+	s := regexp.QuoteMeta(o.NameFormat(o.Name, rollingPeriodMark, rollingIndexMark))
+	s = strings.Replace(s, rollingPeriodMark, fmt.Sprintf(`(\d{%d})`, len(o.periodOf(time.Now()))), 1)
+	s = strings.Replace(s, strconv.Itoa(rollingIndexMark), `(\d+)`, 1)
+	return regexp.MustCompile("^" + s + `(?:\.zip)?$`)
+}
+
+// match 判断name是否为本文件切分出的文件，返回其周期和序号
+func (r *RollingFile) match(name string) (string, int, bool) {
+	return r.opt.matchName(r.pattern, name)
+}
+
+// matchName 用namePattern生成的规则解析文件名，返回其周期和序号，文件名不包含周期时周期为空
+func (o *RollingOpt) matchName(pattern *regexp.Regexp, name string) (string, int, bool) {
+	m := pattern.FindStringSubmatch(name)
+	if m == nil {
+		return "", 0, false
+	}
+	var period string
+	var idx int
+	// NameFormat可能不包含周期，按占位值出现的顺序取子匹配
+	sample := o.NameFormat(o.Name, rollingPeriodMark, rollingIndexMark)
+	pi, ii := strings.Index(sample, rollingPeriodMark), strings.Index(sample, strconv.Itoa(rollingIndexMark))
+	switch {
+	case pi >= 0 && ii >= 0 && pi < ii:
+		period = m[1]
+		idx, _ = strconv.Atoi(m[2])
+	case pi >= 0 && ii >= 0:
+		idx, _ = strconv.Atoi(m[1])
+		period = m[2]
+	case pi >= 0:
+		period = m[1]
+	case ii >= 0:
+		idx, _ = strconv.Atoi(m[1])
+	}
+	return period, idx, true
+}
+
+func (o *RollingOpt) periodOf(t time.Time) string {
+	if o.Interval == RotateHourly {
+		return t.Format(FileTimeFormat + "15")
+	}
+	return t.Format(FileTimeFormat)
+}
+
+func (r *RollingFile) fileName(idx int) string {
+	return filepath.Join(r.opt.Dir, r.opt.NameFormat(r.opt.Name, r.period, idx))
+}
+
+// open 打开当前序号的文件，调用方需持有锁
+func (r *RollingFile) open() error {
+	r.nameNow = r.fileName(r.index)
+	fno, err := os.OpenFile(r.nameNow, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0664)
+	if err != nil {
+		return err
+	}
+	r.fno = fno
+	r.size = 0
+	if fs, err := fno.Stat(); err == nil {
+		r.size = fs.Size()
+	}
+	return nil
+}
+
+// Write 写入数据，写入前检查是否需要按时间或大小切分文件
+func (r *RollingFile) Write(p []byte) (int, error) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	// 上次切分时打开文件失败，重试
+	if r.fno == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if period := r.opt.periodOf(time.Now()); period != r.period {
+		r.period = period
+		r.index = 0
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	} else if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		r.index++
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.fno.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate 关闭当前文件并打开新文件，跳过已存在的序号，调用方需持有锁
+func (r *RollingFile) rotate() error {
+	old := r.nameNow
+	r.fno.Close()
+	r.fno = nil
+	for IsExist(r.fileName(r.index)) || IsExist(r.fileName(r.index)+".zip") {
+		r.index++
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	go func() {
+		defer func() { recover() }()
+		if r.opt.Compress {
+			if err := ZIPFile(filepath.Dir(old), filepath.Base(old), false); err != nil {
+				println(fmt.Sprintf("zip log file error: %s %s", old, err.Error()))
+			} else {
+				os.Remove(old)
+			}
+		}
+		r.clean()
+	}()
+	return nil
+}
+
+// clean 按保留天数和数量清理旧文件
+func (r *RollingFile) clean() {
+	if r.opt.MaxDays <= 0 && r.opt.MaxFiles <= 0 {
+		return
+	}
+	lstfno, err := ioutil.ReadDir(r.opt.Dir)
+	if err != nil {
+		println(fmt.Sprintf("clear log files error: %s", err.Error()))
+		return
+	}
+	r.locker.Lock()
+	current := filepath.Base(r.nameNow)
+	r.locker.Unlock()
+	files := make([]os.FileInfo, 0, len(lstfno))
+	for _, fno := range lstfno {
+		// 忽略目录，其他名称的文件，以及当前文件
+		if fno.IsDir() || fno.Name() == current {
+			continue
+		}
+		if _, _, ok := r.match(fno.Name()); !ok {
+			continue
+		}
+		files = append(files, fno)
+	}
+	t := time.Now()
+	if r.opt.MaxDays > 0 {
+		expired := int64(r.opt.MaxDays)*24*60*60 - 10
+		remain := files[:0]
+		for _, fno := range files {
+			if t.Unix()-fno.ModTime().Unix() >= expired {
+				os.Remove(filepath.Join(r.opt.Dir, fno.Name()))
+				continue
+			}
+			remain = append(remain, fno)
+		}
+		files = remain
+	}
+	// 当前文件也计入数量
+	if r.opt.MaxFiles > 0 && len(files) >= r.opt.MaxFiles {
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].ModTime().Before(files[j].ModTime())
+		})
+		for _, fno := range files[:len(files)-r.opt.MaxFiles+1] {
+			os.Remove(filepath.Join(r.opt.Dir, fno.Name()))
+		}
+	}
+}
+
+// Name 当前写入的文件路径
+func (r *RollingFile) Name() string {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	return r.nameNow
+}
+
+// Sync 同步文件到磁盘
+func (r *RollingFile) Sync() error {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	if r.fno == nil {
+		return nil
+	}
+	return r.fno.Sync()
+}
+
+// Close 关闭文件
+func (r *RollingFile) Close() error {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	r.closed = true
+	if r.fno == nil {
+		return nil
+	}
+	err := r.fno.Close()
+	r.fno = nil
+	return err
+}
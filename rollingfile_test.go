@@ -0,0 +1,108 @@
+package gopsu
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRollingFileRotate(t *testing.T) {
+	period := time.Now().Format(FileTimeFormat)
+	chunk := []byte(strings.Repeat("x", 400*1024) + "\n")
+	cases := []struct {
+		name   string
+		format func(name, period string, idx int) string
+		want   []string
+	}{
+		{"default", nil, []string{
+			"app." + period + ".0.log", "app." + period + ".1.log",
+		}},
+		{"idx-first", func(name, period string, idx int) string {
+			return fmt.Sprintf("%s-%d-%s.txt", name, idx, period)
+		}, []string{
+			"app-0-" + period + ".txt", "app-1-" + period + ".txt",
+		}},
+		{"no-period", func(name, period string, idx int) string {
+			return fmt.Sprintf("%s_%03d.log", name, idx)
+		}, []string{
+			"app_000.log", "app_001.log",
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opt := RollingOpt{Dir: dir, Name: "app", MaxSizeMB: 1, NameFormat: tc.format}
+			rf, err := NewRollingFile(opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				// 3次写满1MB，第4次切分到下一个文件
+				for i := 0; i < 4; i++ {
+					rf.Write(chunk)
+				}
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("rotate did not finish")
+			}
+			if got := filepath.Base(rf.Name()); got != tc.want[1] {
+				t.Errorf("current file = %s, want %s", got, tc.want[1])
+			}
+			rf.Close()
+			for _, name := range tc.want {
+				if !IsExist(filepath.Join(dir, name)) {
+					t.Errorf("missing %s", name)
+				}
+			}
+			// 重新打开时续写序号最大的文件
+			rf, err = NewRollingFile(opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rf.Close()
+			if got := filepath.Base(rf.Name()); got != tc.want[1] {
+				t.Errorf("reopen file = %s, want %s", got, tc.want[1])
+			}
+		})
+	}
+}
+
+func TestRollingFileMatch(t *testing.T) {
+	rf := &RollingFile{opt: RollingOpt{Name: "app", NameFormat: func(name, period string, idx int) string {
+		return fmt.Sprintf("%s-%d-%s.txt", name, idx, period)
+	}}}
+	rf.pattern = rf.opt.namePattern()
+	cases := []struct {
+		file   string
+		period string
+		idx    int
+		ok     bool
+	}{
+		{"app-3-201231.txt", "201231", 3, true},
+		{"app-12-201231.txt.zip", "201231", 12, true},
+		{"app-3-2012.txt", "", 0, false},
+		{"other-3-201231.txt", "", 0, false},
+		{"app.201231.3.log", "", 0, false},
+	}
+	for _, tc := range cases {
+		period, idx, ok := rf.match(tc.file)
+		if period != tc.period || idx != tc.idx || ok != tc.ok {
+			t.Errorf("match(%q) = %q, %d, %v; want %q, %d, %v", tc.file, period, idx, ok, tc.period, tc.idx, tc.ok)
+		}
+	}
+}
+
+func TestRollingFileRequiresIdx(t *testing.T) {
+	_, err := NewRollingFile(RollingOpt{Dir: t.TempDir(), Name: "app", NameFormat: func(name, period string, idx int) string {
+		return name + "." + period + ".log"
+	}})
+	if err == nil {
+		t.Fatal("NameFormat without idx should be rejected")
+	}
+}
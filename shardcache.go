@@ -0,0 +1,107 @@
+package gopsu
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// XShardCache 分片缓存，key按hash分散到多个XCache，降低高并发下的锁竞争
+type XShardCache struct {
+	shards []*XCache
+}
+
+// NewShardCache 创建分片缓存
+//	shards: 分片数量，小于1时为16
+//	l: 缓存总大小，平均分配到各分片，0-不限制
+//	policy: 各分片缓存满时的淘汰策略，默认CacheEvictLRU
+func NewShardCache(shards int, l int64, policy ...CacheEvictPolicy) *XShardCache {
+	if shards < 1 {
+		shards = 16
+	}
+	var sl int64
+	if l > 0 {
+		sl = l / int64(shards)
+		if l%int64(shards) > 0 {
+			sl++
+		}
+	}
+	sc := &XShardCache{
+		shards: make([]*XCache, shards),
+	}
+	for i := range sc.shards {
+		sc.shards[i] = NewCache(sl, policy...)
+	}
+	return sc
+}
+
+// shard 获取key所在分片
+func (sc *XShardCache) shard(k interface{}) *XCache {
+	h := fnv.New32a()
+	switch v := k.(type) {
+	case string:
+		h.Write([]byte(v))
+	case []byte:
+		h.Write(v)
+	default:
+		fmt.Fprintf(h, "%v", v)
+	}
+	return sc.shards[h.Sum32()%uint32(len(sc.shards))]
+}
+
+// Set 设置缓存数据
+//	k: key
+//	v: value
+//	expire: 超时时间（ms）,0-不超时
+func (sc *XShardCache) Set(k, v interface{}, expire int64) bool {
+	return sc.shard(k).Set(k, v, expire)
+}
+
+// Get 读取缓存数据
+func (sc *XShardCache) Get(k interface{}) (interface{}, bool) {
+	return sc.shard(k).Get(k)
+}
+
+// GetWithExpire 读取缓存数据及剩余有效时间（ms），0表示不超时
+func (sc *XShardCache) GetWithExpire(k interface{}) (interface{}, int64, bool) {
+	return sc.shard(k).GetWithExpire(k)
+}
+
+// GetOrLoad 读取缓存数据，不存在时调用loader加载并以expire（ms）写入缓存，同一key的并发加载只执行一次
+func (sc *XShardCache) GetOrLoad(k interface{}, expire int64, loader func() (interface{}, error)) (interface{}, error) {
+	return sc.shard(k).GetOrLoad(k, expire, loader)
+}
+
+// Delete 删除缓存数据
+func (sc *XShardCache) Delete(k interface{}) {
+	sc.shard(k).Delete(k)
+}
+
+// Clear 清空缓存
+func (sc *XShardCache) Clear() {
+	for _, s := range sc.shards {
+		s.Clear()
+	}
+}
+
+// Len 获取缓存数量
+func (sc *XShardCache) Len() int64 {
+	var n int64
+	for _, s := range sc.shards {
+		n += s.Len()
+	}
+	return n
+}
+
+// OnEvict 设置数据移除回调，参见XCache.OnEvict
+func (sc *XShardCache) OnEvict(f func(key, value interface{}, reason CacheEvictReason)) {
+	for _, s := range sc.shards {
+		s.OnEvict(f)
+	}
+}
+
+// Close 停止所有分片的后台超时清理
+func (sc *XShardCache) Close() {
+	for _, s := range sc.shards {
+		s.Close()
+	}
+}
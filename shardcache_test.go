@@ -0,0 +1,147 @@
+package gopsu
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// loadingCache XCache和XShardCache共有的读取加载接口
+type loadingCache interface {
+	Get(k interface{}) (interface{}, bool)
+	GetOrLoad(k interface{}, expire int64, loader func() (interface{}, error)) (interface{}, error)
+	Close()
+}
+
+func TestGetOrLoadSingleFlight(t *testing.T) {
+	caches := []struct {
+		name string
+		new  func() loadingCache
+	}{
+		{"xcache", func() loadingCache { return NewCache(0) }},
+		{"shard", func() loadingCache { return NewShardCache(8, 0) }},
+	}
+	for _, cc := range caches {
+		t.Run(cc.name, func(t *testing.T) {
+			c := cc.new()
+			defer c.Close()
+			var calls int32
+			release := make(chan struct{})
+			loader := func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "v", nil
+			}
+			var wg sync.WaitGroup
+			errs := make(chan error, 50)
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					v, err := c.GetOrLoad("k", 60000, loader)
+					if err != nil || v != "v" {
+						errs <- fmt.Errorf("got %v, %v", v, err)
+					}
+				}()
+			}
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+			if calls != 1 {
+				t.Errorf("loader called %d times", calls)
+			}
+			if v, ok := c.Get("k"); !ok || v != "v" {
+				t.Errorf("cached value = %v, %v", v, ok)
+			}
+		})
+	}
+}
+
+func TestGetOrLoadError(t *testing.T) {
+	xc := NewCache(0)
+	defer xc.Close()
+	cases := []struct {
+		name   string
+		loader func() (interface{}, error)
+		errStr string
+	}{
+		{"error", func() (interface{}, error) { return nil, fmt.Errorf("boom") }, "boom"},
+		{"panic", func() (interface{}, error) { panic("bad") }, "cache loader for k panicked: bad"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			started := make(chan struct{})
+			release := make(chan struct{})
+			loader := func() (interface{}, error) {
+				close(started)
+				<-release
+				return tc.loader()
+			}
+			// 发起加载的调用，panic会继续向上传递
+			go func() {
+				defer func() { recover() }()
+				xc.GetOrLoad("k", 0, loader)
+			}()
+			<-started
+			waiter := make(chan error, 1)
+			go func() {
+				_, err := xc.GetOrLoad("k", 0, func() (interface{}, error) { return "second", nil })
+				waiter <- err
+			}()
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+			select {
+			case err := <-waiter:
+				if err == nil || err.Error() != tc.errStr {
+					t.Errorf("waiter err = %v, want %s", err, tc.errStr)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("waiter blocked")
+			}
+			// 失败的结果不写入缓存，再次调用重新加载
+			if _, ok := xc.Get("k"); ok {
+				t.Error("failed load was cached")
+			}
+			if v, err := xc.GetOrLoad("k", 0, func() (interface{}, error) { return "ok", nil }); err != nil || v != "ok" {
+				t.Errorf("reload = %v, %v", v, err)
+			}
+			xc.Delete("k")
+		})
+	}
+}
+
+func TestXShardCache(t *testing.T) {
+	sc := NewShardCache(4, 40)
+	defer sc.Close()
+	var evicted int32
+	sc.OnEvict(func(key, value interface{}, reason CacheEvictReason) {
+		atomic.AddInt32(&evicted, 1)
+	})
+	for i := 0; i < 100; i++ {
+		sc.Set(i, i, 0)
+	}
+	// 容量按分片平均分配，每片10条
+	if n := sc.Len(); n != 40 {
+		t.Errorf("Len = %d", n)
+	}
+	if n := atomic.LoadInt32(&evicted); n != 60 {
+		t.Errorf("evicted = %d", n)
+	}
+	if v, ok := sc.Get(99); !ok || v != 99 {
+		t.Errorf("Get(99) = %v, %v", v, ok)
+	}
+	sc.Delete(99)
+	if _, ok := sc.Get(99); ok {
+		t.Error("deleted key found")
+	}
+	sc.Clear()
+	if n := sc.Len(); n != 0 {
+		t.Errorf("Len after Clear = %d", n)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"crypto/cipher"
 	"crypto/hmac"
 	"crypto/md5"
+	crand "crypto/rand"
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
@@ -76,6 +77,12 @@ const (
 	CryptoAES256CBC
 	// CryptoAES256CFB aes256cfb算法
 	CryptoAES256CFB
+	// CryptoAES128GCM aes128gcm算法，每次加密使用随机nonce，无需iv
+	CryptoAES128GCM
+	// CryptoAES192GCM aes192gcm算法，每次加密使用随机nonce，无需iv
+	CryptoAES192GCM
+	// CryptoAES256GCM aes256gcm算法，每次加密使用随机nonce，无需iv
+	CryptoAES256GCM
 )
 
 // CryptoWorker 序列化或加密管理器
@@ -85,6 +92,7 @@ type CryptoWorker struct {
 	cryptoLocker sync.Mutex
 	cryptoIV     []byte
 	cryptoBlock  cipher.Block
+	cryptoAEAD   cipher.AEAD
 }
 
 var (
@@ -176,6 +184,17 @@ func (h *CryptoWorker) SetKey(key, iv string) error {
 		}
 		h.cryptoBlock, _ = aes.NewCipher([]byte(key)[:32])
 		h.cryptoIV = []byte(iv)[:32]
+	case CryptoAES128GCM, CryptoAES192GCM, CryptoAES256GCM:
+		l := map[byte]int{CryptoAES128GCM: 16, CryptoAES192GCM: 24, CryptoAES256GCM: 32}[h.cryptoType]
+		if len(key) < l {
+			return fmt.Errorf("key must be longer than %d", l)
+		}
+		h.cryptoBlock, _ = aes.NewCipher([]byte(key)[:l])
+		aead, err := cipher.NewGCM(h.cryptoBlock)
+		if err != nil {
+			return err
+		}
+		h.cryptoAEAD = aead
 	default:
 		return fmt.Errorf("not yet supported")
 	}
@@ -186,6 +205,14 @@ func (h *CryptoWorker) SetKey(key, iv string) error {
 func (h *CryptoWorker) Encrypt(s string) string {
 	// h.cryptoLocker.Lock()
 	// defer h.cryptoLocker.Unlock()
+	if h.cryptoAEAD != nil {
+		// nonce附加在密文之前
+		nonce := make([]byte, h.cryptoAEAD.NonceSize(), h.cryptoAEAD.NonceSize()+len(s)+h.cryptoAEAD.Overhead())
+		if _, err := crand.Read(nonce); err != nil {
+			return ""
+		}
+		return base64.StdEncoding.EncodeToString(h.cryptoAEAD.Seal(nonce, nonce, []byte(s), nil))
+	}
 	if len(h.cryptoIV) == 0 {
 		return ""
 	}
@@ -213,6 +240,10 @@ func (h *CryptoWorker) Decrypt(s string) string {
 	// h.cryptoLocker.Lock()
 	// defer h.cryptoLocker.Unlock()
 	defer func() { recover() }()
+	if h.cryptoAEAD != nil {
+		v, _ := h.decryptAEAD(s)
+		return v
+	}
 	if len(h.cryptoIV) == 0 {
 		return ""
 	}
@@ -236,6 +267,65 @@ func (h *CryptoWorker) Decrypt(s string) string {
 	return ""
 }
 
+// decryptAEAD aes-gcm解密，可区分解密失败和空明文
+func (h *CryptoWorker) decryptAEAD(s string) (string, error) {
+	msg, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return "", err
+	}
+	n := h.cryptoAEAD.NonceSize()
+	if len(msg) < n {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+	b, err := h.cryptoAEAD.Open(nil, msg[:n], msg[n:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// LoadCryptoKey 读取密钥，环境变量env有值时优先使用，否则读取文件keyfile
+//	密钥内容为hex或base64编码的16,24,32字节数据，首尾空白会被忽略
+func LoadCryptoKey(keyfile, env string) ([]byte, error) {
+	var s string
+	if env != "" {
+		s = os.Getenv(env)
+	}
+	if s == "" && keyfile != "" {
+		b, err := ioutil.ReadFile(keyfile)
+		if err != nil {
+			return nil, err
+		}
+		s = string(b)
+	}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("crypto key not found")
+	}
+	if b, err := hex.DecodeString(s); err == nil && checkCryptoKeyLen(b) {
+		return b, nil
+	}
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil && checkCryptoKeyLen(b) {
+		return b, nil
+	}
+	return nil, fmt.Errorf("crypto key must be hex or base64 encoded 16, 24 or 32 bytes")
+}
+
+func checkCryptoKeyLen(b []byte) bool {
+	return len(b) == 16 || len(b) == 24 || len(b) == 32
+}
+
+// GCMCryptoType 按密钥长度返回对应的aes-gcm算法
+func GCMCryptoType(key []byte) byte {
+	switch len(key) {
+	case 16:
+		return CryptoAES128GCM
+	case 24:
+		return CryptoAES192GCM
+	}
+	return CryptoAES256GCM
+}
+
 // Hash 计算序列
 func (h *CryptoWorker) Hash(b []byte) string {
 	h.cryptoLocker.Lock()
@@ -1033,9 +1123,9 @@ func SwapCase(s string) string {
 	var ns bytes.Buffer
 	for _, v := range s {
 		if v >= 65 && v <= 90 {
-			ns.WriteString(string(int(v) + 32))
+			ns.WriteString(string(v + 32))
 		} else if v >= 97 && v <= 122 {
-			ns.WriteString(string(int(v) - 32))
+			ns.WriteString(string(v - 32))
 		} else {
 			ns.WriteString(string(v))
 		}